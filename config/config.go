@@ -52,6 +52,10 @@ func ReadConfig() (*CrusherConfig, error) {
 
 // Interactive new server setup
 func (c *CrusherConfig) AddServer() error {
+	if !servers.Interactive() {
+		return servers.NotInteractiveError("What would you like to name this server?")
+	}
+
 	c.addServerDialog()
 
 	more := terminal.PromptBool("Awesome! Do you want to configure any more servers?")
@@ -80,6 +84,14 @@ func (c *CrusherConfig) SaveConfig() error {
 
 		// Hack to get bools to play nice, and not just output "<bool Value>" - I'll probably open a pull request once I track down the issue.
 		cfg.Section(server.Name).NewKey("PassAuth", fmt.Sprintf("%t", server.PassAuth))
+
+		// Same goes for durations, which would otherwise be saved as nanoseconds
+		if server.ConnectTimeout > 0 {
+			cfg.Section(server.Name).NewKey("ConnectTimeout", server.ConnectTimeout.String())
+		}
+		if server.CommandTimeout > 0 {
+			cfg.Section(server.Name).NewKey("CommandTimeout", server.CommandTimeout.String())
+		}
 	}
 
 	err := cfg.SaveToIndent(configLocation, "\t")
@@ -90,8 +102,64 @@ func (c *CrusherConfig) SaveConfig() error {
 	return nil
 }
 
+// Imports the Host aliases in ~/.ssh/config as servers. Only the alias is saved as the Host, so the
+// connection settings stay in the ssh config and are resolved each time we connect.
+func (c *CrusherConfig) ImportSSHConfig(spec string) error {
+	sshConfig, err := servers.ReadSSHConfig()
+	if err != nil {
+		return err
+	}
+
+	var imports servers.Servers
+	var resolved servers.Servers
+	for _, alias := range sshConfig.Aliases() {
+		if _, exists := c.Servers.Find(alias); exists {
+			continue
+		}
+		if _, exists := imports.Find(alias); exists {
+			continue
+		}
+
+		server := servers.New(alias, alias, "", spec, false)
+		imports = append(imports, *server)
+		resolved = append(resolved, sshConfig.Resolve(*server))
+	}
+
+	if len(imports) == 0 {
+		terminal.Information("There are no new hosts to import from ~/.ssh/config")
+		return nil
+	}
+
+	terminal.Information(fmt.Sprintf("I found the following [%d] new hosts in ~/.ssh/config:", len(imports)))
+	resolved.PrintAllServerInfo()
+
+	if !servers.Interactive() {
+		return servers.NotInteractiveError("Do you want to import these servers?")
+	}
+
+	if !terminal.PromptBool("Do you want to import these servers?") {
+		terminal.Information("Okay, maybe next time..")
+		return nil
+	}
+
+	if spec == "" {
+		spec = terminal.PromptString("What Spec would you like to assign to these servers?")
+		for i := range imports {
+			imports[i].Spec = spec
+		}
+	}
+
+	c.Servers = append(c.Servers, imports...)
+
+	return c.SaveConfig()
+}
+
 // Delete a specific server from the config file
 func (c *CrusherConfig) DeleteServer() error {
+	if !servers.Interactive() {
+		return servers.NotInteractiveError("Which server would you like to delete from the config?")
+	}
+
 	count := len(c.Servers)
 	terminal.Information(fmt.Sprintf("There are [%d] servers configured currently", count))
 	c.Servers.PrintAllServerInfo()
@@ -117,6 +185,9 @@ func (c *CrusherConfig) addServerDialog() {
 	passAuth := terminal.PromptBool(fmt.Sprintf("Does [%s] require password authentication?", name))
 
 	server := servers.New(name, host, username, spec, passAuth)
+	if !passAuth {
+		server.IdentityFile = terminal.PromptString(fmt.Sprintf("Which private key should be used for [%s]? (leave empty to use ssh-agent and the default keys)", name))
+	}
 	server.PrintServerInfo()
 
 	correct := terminal.PromptBool("Great! Does that look correct?")
@@ -6,6 +6,8 @@ import (
 
 	"github.com/murdinc/cli"
 	"github.com/murdinc/crusher/config"
+	"github.com/murdinc/crusher/jobs"
+	"github.com/murdinc/crusher/servers"
 	"github.com/murdinc/crusher/specr"
 	"github.com/murdinc/terminal"
 )
@@ -17,6 +19,17 @@ func main() {
 	var class string
 	var sequence string
 	var locale string
+	var trustNewHosts bool
+	var parallel int
+	var batch int
+	var batchPercent int
+	var maxFailures int
+	var uploads int
+	var assumeYes bool
+	var passwordFile string
+	var output string
+	var dryRun bool
+	var family string
 
 	app := cli.NewApp()
 	app.Name = "crusher"
@@ -47,6 +60,58 @@ func main() {
 			Arguments: []cli.Argument{
 				cli.Argument{Name: "search", Description: "The server or spec group to remote configure", Optional: false},
 			},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "trust-new-hosts",
+					Destination: &trustNewHosts,
+					Usage:       "accept and record the host keys of servers not yet in known_hosts",
+				},
+				cli.IntFlag{
+					Name:        "parallel",
+					Destination: &parallel,
+					Usage:       "most servers to configure at once",
+				},
+				cli.IntFlag{
+					Name:        "batch",
+					Destination: &batch,
+					Usage:       "servers per rolling batch, each batch starts once the previous one succeeded",
+				},
+				cli.IntFlag{
+					Name:        "batch-percent",
+					Destination: &batchPercent,
+					Usage:       "servers per rolling batch, as a percentage of the matching servers",
+				},
+				cli.IntFlag{
+					Name:        "max-failures",
+					Destination: &maxFailures,
+					Usage:       "stop starting new servers once this many have failed",
+				},
+				cli.IntFlag{
+					Name:        "uploads",
+					Destination: &uploads,
+					Usage:       "most files to upload at once to each server, at most 8",
+				},
+				cli.BoolFlag{
+					Name:        "yes",
+					Destination: &assumeYes,
+					Usage:       "configure the servers without asking first",
+				},
+				cli.StringFlag{
+					Name:        "password-file",
+					Destination: &passwordFile,
+					Usage:       "file holding the password for servers with password auth",
+				},
+				cli.BoolFlag{
+					Name:        "dry-run",
+					Destination: &dryRun,
+					Usage:       "show what would change without changing anything",
+				},
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &output,
+					Usage:       "output format, text or json",
+				},
+			},
 			Action: func(c *cli.Context) error {
 				specList, err := specr.GetSpecs()
 				if err != nil {
@@ -54,9 +119,26 @@ func main() {
 					return err
 				}
 
+				if c.Int("batch-percent") < 0 || c.Int("batch-percent") > 100 {
+					err := fmt.Errorf("The --batch-percent flag must be between 0 and 100, got [%d]", c.Int("batch-percent"))
+					terminal.ShowErrorMessage("Invalid Batch Size!", err.Error())
+					return err
+				}
+
 				cfg := getConfig()
-				cfg.Servers.RemoteConfigure(c.NamedArg("search"), specList)
-				return nil
+
+				return cfg.Servers.RemoteConfigure(c.NamedArg("search"), specList, servers.RemoteOptions{
+					TrustNewHosts: c.Bool("trust-new-hosts"),
+					Parallel:      c.Int("parallel"),
+					BatchSize:     c.Int("batch"),
+					BatchPercent:  c.Int("batch-percent"),
+					MaxFailures:   c.Int("max-failures"),
+					Uploads:       c.Int("uploads"),
+					AssumeYes:     c.Bool("yes"),
+					PasswordFile:  c.String("password-file"),
+					DryRun:        c.Bool("dry-run"),
+					Output:        c.String("output"),
+				})
 			},
 		},
 		{
@@ -83,6 +165,16 @@ func main() {
 					Destination: &locale,
 					Usage:       "server location",
 				},
+				cli.BoolFlag{
+					Name:        "dry-run",
+					Destination: &dryRun,
+					Usage:       "show what would change without changing anything",
+				},
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &output,
+					Usage:       "output format, text or json",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				specList, err := specr.GetSpecs()
@@ -97,8 +189,121 @@ func main() {
 					return nil
 				}
 
-				specList.LocalConfigure(specName, c.String("class"), c.String("sequence"), c.String("locale"))
-				return nil
+				return jobs.LocalConfigure(specList, specName, jobs.LocalOptions{
+					Vars: jobs.Vars{
+						Class:    c.String("class"),
+						Sequence: c.String("sequence"),
+						Locale:   c.String("locale"),
+					},
+					DryRun: c.Bool("dry-run"),
+					Output: c.String("output"),
+				})
+			},
+		},
+		{
+			Name:        "rollback",
+			ShortName:   "rb",
+			Usage:       "crusher rollback web01 20170102-150405",
+			Description: "Restore the files replaced by a previous run on one or many remote servers",
+			Arguments: []cli.Argument{
+				cli.Argument{Name: "search", Description: "The server or spec group to roll back", Optional: false},
+				cli.Argument{Name: "run-id", Description: "The run to roll back, defaults to the latest one", Optional: true},
+			},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "trust-new-hosts",
+					Destination: &trustNewHosts,
+					Usage:       "accept and record the host keys of servers not yet in known_hosts",
+				},
+				cli.IntFlag{
+					Name:        "parallel",
+					Destination: &parallel,
+					Usage:       "most servers to roll back at once",
+				},
+				cli.BoolFlag{
+					Name:        "yes",
+					Destination: &assumeYes,
+					Usage:       "roll back the servers without asking first",
+				},
+				cli.StringFlag{
+					Name:        "password-file",
+					Destination: &passwordFile,
+					Usage:       "file holding the password for servers with password auth",
+				},
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &output,
+					Usage:       "output format, text or json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				cfg := getConfig()
+				return cfg.Servers.RemoteRollback(c.NamedArg("search"), c.NamedArg("run-id"), servers.RemoteOptions{
+					TrustNewHosts: c.Bool("trust-new-hosts"),
+					Parallel:      c.Int("parallel"),
+					AssumeYes:     c.Bool("yes"),
+					PasswordFile:  c.String("password-file"),
+					Output:        c.String("output"),
+				})
+			},
+		},
+		{
+			Name:        "local-rollback",
+			ShortName:   "lrb",
+			Usage:       "crusher local-rollback 20170102-150405",
+			Description: "Restore the files replaced by a previous run on this local machine",
+			Arguments: []cli.Argument{
+				cli.Argument{Name: "run-id", Description: "The run to roll back, defaults to the latest one", Optional: true},
+			},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &output,
+					Usage:       "output format, text or json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				return jobs.LocalRollback(c.NamedArg("run-id"), c.String("output"))
+			},
+		},
+		{
+			Name:        "facts",
+			ShortName:   "f",
+			Usage:       "crusher facts web01",
+			Description: "Show the facts of one or many remote servers, as used by fact.* template variables",
+			Arguments: []cli.Argument{
+				cli.Argument{Name: "search", Description: "The server or spec group to show the facts of", Optional: false},
+			},
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:        "trust-new-hosts",
+					Destination: &trustNewHosts,
+					Usage:       "accept and record the host keys of servers not yet in known_hosts",
+				},
+				cli.IntFlag{
+					Name:        "parallel",
+					Destination: &parallel,
+					Usage:       "most servers to gather facts from at once",
+				},
+				cli.StringFlag{
+					Name:        "password-file",
+					Destination: &passwordFile,
+					Usage:       "file holding the password for servers with password auth",
+				},
+				cli.StringFlag{
+					Name:        "output",
+					Destination: &output,
+					Usage:       "output format, text or json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				cfg := getConfig()
+				return cfg.Servers.RemoteFacts(c.NamedArg("search"), servers.RemoteOptions{
+					TrustNewHosts: c.Bool("trust-new-hosts"),
+					Parallel:      c.Int("parallel"),
+					PasswordFile:  c.String("password-file"),
+					Output:        c.String("output"),
+				})
 			},
 		},
 		{
@@ -111,6 +316,19 @@ func main() {
 				return cfg.AddServer()
 			},
 		},
+		{
+			Name:        "import-ssh-config",
+			ShortName:   "i",
+			Usage:       "crusher import-ssh-config hello_world",
+			Description: "Add the hosts in ~/.ssh/config as remote servers",
+			Arguments: []cli.Argument{
+				cli.Argument{Name: "spec", Description: "The spec to assign to the imported servers", Optional: true},
+			},
+			Action: func(c *cli.Context) error {
+				cfg, _ := config.ReadConfig() // an empty config is fine here
+				return cfg.ImportSSHConfig(c.NamedArg("spec"))
+			},
+		},
 		{
 			Name:        "delete-server",
 			ShortName:   "d",
@@ -147,7 +365,19 @@ func main() {
 			Arguments: []cli.Argument{
 				cli.Argument{Name: "spec", Description: "The spec to show", Optional: false},
 			},
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:        "family",
+					Destination: &family,
+					Usage:       "show what the spec builds on this family of servers, debian, redhat, alpine, arch or suse",
+				},
+			},
 			Action: func(c *cli.Context) error {
+				if err := specr.ValidateFamily(family); err != nil {
+					terminal.ShowErrorMessage("Invalid Family!", err.Error())
+					return err
+				}
+
 				specList, err := specr.GetSpecs()
 				if err != nil {
 					terminal.ShowErrorMessage("Error Reading Spec Files!", err.Error())
@@ -159,19 +389,27 @@ func main() {
 					return nil
 				}
 
-				specList.ShowSpecBuild(specName)
+				specList.ShowSpecBuild(specName, family)
 				return nil
 			},
 		},
 	}
 
-	app.Run(os.Args)
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
 }
 
 func getConfig() *config.CrusherConfig {
 	// Check Config
 	cfg, err := config.ReadConfig()
 	if err != nil || len(cfg.Servers) == 0 {
+		if !servers.Interactive() {
+			terminal.ShowErrorMessage("Crusher configuration file not found or empty!", "Add some servers with the add-server command first, stdin is not a terminal so I can't ask you about them now.")
+			os.Exit(1)
+			return nil
+		}
+
 		// No Config Found, ask if we want to create one
 		create := terminal.BoxPromptBool("Crusher configuration file not found or empty!", "Do you want to add some servers now?")
 		if !create {
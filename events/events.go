@@ -0,0 +1,265 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/murdinc/crusher/facts"
+	"github.com/murdinc/terminal"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Phases of a configuration job
+const (
+	Setup             = "setup"
+	Schedule          = "schedule"
+	Connect           = "connect"
+	Elevate           = "elevate"
+	PreConfiguration  = "pre-configuration"
+	Packages          = "packages"
+	FileTransfer      = "file-transfer"
+	PostConfiguration = "post-configuration"
+	Handlers          = "handlers"
+	Facts             = "facts"
+	Rollback          = "rollback"
+	Summary           = "summary"
+)
+
+// Statuses of an event
+const (
+	Started   = "started"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+	Skipped   = "skipped"
+	Notice    = "notice"
+	Info      = "info"
+	Updated   = "updated"   // A file was written
+	Unchanged = "unchanged" // A file already matched, so it was left alone
+	Deleted   = "deleted"   // A file was removed from a synced folder
+)
+
+// A single thing that happened during a run, Server and Host are empty for local jobs
+type Event struct {
+	Server    string        `json:"server,omitempty"`
+	Host      string        `json:"host,omitempty"`
+	Phase     string        `json:"phase"`
+	Step      string        `json:"step,omitempty"` // The command or file the event is about
+	Status    string        `json:"status"`
+	Message   string        `json:"message,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Stdout    string        `json:"stdout,omitempty"`
+	Stderr    string        `json:"stderr,omitempty"`
+	Diff      string        `json:"diff,omitempty"`  // Unified diff of a file that would change, from dry runs
+	Facts     *facts.Facts  `json:"facts,omitempty"` // From the facts command
+	Duration  time.Duration `json:"-"`               // Encoded in seconds
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// Encodes the event with its duration in seconds
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	return json.Marshal(struct {
+		event
+		Duration float64 `json:"duration,omitempty"`
+	}{event(e), e.Duration.Seconds()})
+}
+
+// Consumes the events of a run
+type Renderer interface {
+	Render(e Event)
+	Summary(results []Event) // One Summary phase event per server
+}
+
+// Output formats
+const (
+	TextOutput = "text"
+	JSONOutput = "json"
+)
+
+// Returns the renderer for an output format
+func NewRenderer(output string) (Renderer, error) {
+	switch output {
+	case "", TextOutput:
+		return new(TerminalRenderer), nil
+	case JSONOutput:
+		return NewJSONRenderer(os.Stdout), nil
+	}
+	return nil, fmt.Errorf("Unknown output format [%s], expected [%s] or [%s]", output, TextOutput, JSONOutput)
+}
+
+// Checks if a renderer writes machine readable output, so nothing else should be printed
+func IsJSON(r Renderer) bool {
+	_, ok := r.(*JSONRenderer)
+	return ok
+}
+
+// Renders events until the channel is closed, the returned channel is closed once everything is rendered
+func Drain(events <-chan Event, r Renderer) <-chan bool {
+	done := make(chan bool)
+	go func() {
+		for e := range events {
+			r.Render(e)
+		}
+		close(done)
+	}()
+	return done
+}
+
+// Coloured terminal output
+////////////////..........
+type TerminalRenderer struct{}
+
+func (t *TerminalRenderer) Render(e Event) {
+	if e.Server == "" {
+		t.renderLocal(e)
+		return
+	}
+
+	line := addSpaces("[%s] ["+e.Server+" - "+e.Host+"]", 45) + " >> %s " // status, name, host, message
+
+	switch e.Status {
+	case Started:
+		printResp(fmt.Sprintf(line, "*", e.Message))
+	case Succeeded, Updated:
+		printResp(fmt.Sprintf(line, "✓", e.Message))
+	case Failed:
+		printErr(fmt.Sprintf(line, "X", e.Message))
+		if e.Error != "" {
+			printErr(fmt.Sprintf(line, "X", e.Error))
+		}
+	default:
+		printResp(fmt.Sprintf(line, "-", e.Message))
+	}
+
+	// TODO handle more verbose output, maybe from a verbose cli flag
+	if e.Status == Failed {
+		printOutput(e, printResp)
+	}
+	printDiff(e.Diff)
+	printFacts(e.Facts)
+}
+
+func (t *TerminalRenderer) renderLocal(e Event) {
+	switch e.Status {
+	case Started:
+		terminal.Delta(e.Message)
+	case Succeeded, Updated:
+		terminal.Information(e.Message)
+	case Failed:
+		printOutput(e, terminal.Response)
+		if e.Error != "" {
+			terminal.ErrorLine(e.Error)
+		}
+		terminal.ErrorLine(e.Message)
+	case Notice, Skipped:
+		terminal.Notice(e.Message)
+	default:
+		terminal.Response(e.Message)
+	}
+	printDiff(e.Diff)
+	printFacts(e.Facts)
+}
+
+// Prints how each server did in a table
+func (t *TerminalRenderer) Summary(results []Event) {
+	collumns := []string{"Name", "Host", "Status", "Failed Step", "Duration"}
+	var rows [][]string
+
+	for _, e := range results {
+		duration := ""
+		if e.Duration > 0 {
+			duration = fmt.Sprintf("%.1fs", e.Duration.Seconds())
+		}
+		rows = append(rows, []string{e.Server, e.Host, e.Status, e.Step, duration})
+	}
+
+	terminal.Information("Summary:")
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(collumns)
+	table.AppendBulk(rows)
+	table.Render()
+}
+
+func printOutput(e Event, print func(string)) {
+	if e.Stdout != "" {
+		print(e.Stdout)
+	}
+	if e.Stderr != "" {
+		print(e.Stderr)
+	}
+}
+
+// Prints facts in a table
+func printFacts(f *facts.Facts) {
+	if f == nil {
+		return
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Fact", "Value"})
+	table.AppendBulk(f.Rows())
+	table.Render()
+}
+
+// Prints a unified diff, with added lines in green and removed lines in red
+func printDiff(diff string) {
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++"):
+			printResp(strings.TrimSuffix(line, "\n"))
+		case strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---"):
+			printErr(strings.TrimSuffix(line, "\n"))
+		default:
+			fmt.Print(line)
+		}
+	}
+}
+
+func printResp(msg string) {
+	template := `{{ ansi "fggreen"}}{{ . }}{{ansi ""}}
+	`
+	terminal.PrintAnsi(template, msg)
+}
+
+func printErr(msg string) {
+	template := `{{ ansi "fgred"}}{{ . }}{{ansi ""}}
+	`
+	terminal.PrintAnsi(template, msg)
+}
+
+func addSpaces(s string, w int) string {
+	if len(s) < w {
+		s += strings.Repeat(" ", w-len(s))
+	}
+	return s
+}
+
+// Newline delimited JSON output
+////////////////..........
+type JSONRenderer struct {
+	sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewJSONRenderer(w io.Writer) *JSONRenderer {
+	return &JSONRenderer{encoder: json.NewEncoder(w)}
+}
+
+func (j *JSONRenderer) Render(e Event) {
+	j.Lock()
+	defer j.Unlock()
+	j.encoder.Encode(e)
+}
+
+func (j *JSONRenderer) Summary(results []Event) {
+	for _, e := range results {
+		j.Render(e)
+	}
+}
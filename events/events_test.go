@@ -0,0 +1,24 @@
+package events_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	r := events.NewJSONRenderer(&buf)
+
+	r.Render(events.Event{Server: "web1", Phase: events.Packages, Status: events.Failed, Error: "exit status 100", Duration: 1500 * time.Millisecond})
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "web1", decoded["server"])
+	assert.Equal(t, events.Failed, decoded["status"])
+	assert.Equal(t, 1.5, decoded["duration"])
+}
@@ -15,8 +15,21 @@ REQUIRES = nginx, php
 [CONTENT]
 	source = spec
 	# source = git
-	# git_command = git clone ...
+	# git_url = https://github.com/example/site.git
+	# git_ref = master
+	# git_subdir = public
+	# source = archive
+	# archive = https://example.com/site.tar.gz
+	# archive_sha256 = <sha256 of the archive>
+	# archive_on_host = false
 	debian_root = "/var/www/html/"
+	owner = www-data
+	group = www-data
+	mode = 0644
+	dir_mode = 0755
+
+[PERMISSIONS]
+	/etc/nginx/sites-available/ = root:root 0644
 
 [COMMANDS]
 
@@ -13,6 +13,10 @@ REQUIRES =
 	debian_root = "/etc/"
 
 [COMMANDS]
-	post = "sudo service nginx start, sudo service nginx reload"
+	post = "sudo service nginx start"
+
+[HANDLERS.nginx_reload]
+	command = sudo service nginx reload
+	paths = /etc/nginx/
 
 
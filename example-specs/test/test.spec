@@ -14,7 +14,13 @@ REQUIRES =
 [CONTENT]
 	source = spec
 	# source = git
-	# git_command = git clone ...
+	# git_url = https://github.com/example/site.git
+	# git_ref = master
+	# git_subdir = public
+	# source = archive
+	# archive = https://example.com/site.tar.gz
+	# archive_sha256 = <sha256 of the archive>
+	# archive_on_host = false
 	debian_root = "/var/log/"
 
 [COMMANDS]
@@ -0,0 +1,133 @@
+package facts
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hil/ast"
+	"github.com/murdinc/crusher/specr"
+)
+
+// What a configuration job knows about the machine it runs on
+type Facts struct {
+	Hostname       string   `json:"hostname"`
+	OSID           string   `json:"os_id"`
+	OSName         string   `json:"os_name"`
+	OSVersion      string   `json:"os_version"`
+	OSFamily       string   `json:"os_family"`
+	Kernel         string   `json:"kernel"`
+	Architecture   string   `json:"architecture"`
+	CPUs           int      `json:"cpus"`
+	MemoryMB       int      `json:"memory_mb"`
+	IPs            []string `json:"ips"`
+	PackageManager string   `json:"package_manager"` // The first of the supported package managers found on the machine
+	Release        string   `json:"-"`               // The contents of /etc/os-release
+}
+
+// Separates the contents of /etc/os-release from the rest of the output of Command
+const releaseMarker = "--os-release--"
+
+// Prints the facts of a machine as key=value lines, followed by its /etc/os-release. Runs under sh
+// whatever the login shell is, and needs no root
+var Command = "sh -c '" + strings.Join([]string{
+	`echo hostname=$(hostname 2>/dev/null || cat /etc/hostname)`,
+	`echo kernel=$(uname -r)`,
+	`echo architecture=$(uname -m)`,
+	`echo cpus=$(getconf _NPROCESSORS_ONLN 2>/dev/null || nproc 2>/dev/null)`,
+	`echo memory_kb=$(sed -n "s/^MemTotal: *\([0-9]*\).*/\1/p" /proc/meminfo 2>/dev/null)`,
+	`echo ips=$(hostname -I 2>/dev/null || ip -o -4 addr show scope global 2>/dev/null | sed "s/.* inet \([^/]*\).*/\1/")`,
+	`for m in apt-get dnf yum apk pacman zypper; do if command -v $m >/dev/null 2>&1; then echo package_manager=$m; break; fi; done`,
+	`echo ` + releaseMarker,
+	`cat /etc/os-release 2>/dev/null`,
+}, "\n") + "'"
+
+// Reads the output of Command
+func Parse(out string) *Facts {
+	f := new(Facts)
+
+	parts := strings.SplitN(out, releaseMarker+"\n", 2)
+	if len(parts) == 2 {
+		f.Release = parts[1]
+	}
+
+	for _, line := range strings.Split(parts[0], "\n") {
+		kv := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+
+		switch kv[0] {
+		case "hostname":
+			f.Hostname = value
+		case "kernel":
+			f.Kernel = value
+		case "architecture":
+			f.Architecture = value
+		case "cpus":
+			f.CPUs, _ = strconv.Atoi(value)
+		case "memory_kb":
+			kb, _ := strconv.Atoi(value)
+			f.MemoryMB = kb / 1024
+		case "ips":
+			f.IPs = strings.Fields(value)
+		case "package_manager":
+			f.PackageManager = value
+		}
+	}
+
+	// Unsupported distributions still have an ID and name
+	distro, _ := specr.ParseOSRelease(f.Release)
+	f.OSID = distro.ID
+	f.OSName = distro.Name
+	f.OSVersion = distro.VersionID
+	f.OSFamily = distro.Family
+
+	return f
+}
+
+// Returns the first IP address of the machine
+func (f *Facts) IP() string {
+	if len(f.IPs) == 0 {
+		return ""
+	}
+	return f.IPs[0]
+}
+
+// Returns the facts as fact.* template variables
+func (f *Facts) Vars() map[string]ast.Variable {
+	str := func(s string) ast.Variable { return ast.Variable{Type: ast.TypeString, Value: s} }
+	num := func(i int) ast.Variable { return ast.Variable{Type: ast.TypeInt, Value: i} }
+
+	return map[string]ast.Variable{
+		"fact.hostname":        str(f.Hostname),
+		"fact.os_id":           str(f.OSID),
+		"fact.os_name":         str(f.OSName),
+		"fact.os_version":      str(f.OSVersion),
+		"fact.os_family":       str(f.OSFamily),
+		"fact.kernel":          str(f.Kernel),
+		"fact.architecture":    str(f.Architecture),
+		"fact.cpus":            num(f.CPUs),
+		"fact.memory_mb":       num(f.MemoryMB),
+		"fact.ip":              str(f.IP()),
+		"fact.ips":             str(strings.Join(f.IPs, " ")),
+		"fact.package_manager": str(f.PackageManager),
+	}
+}
+
+// Returns the facts as name and value rows, for printing in a table
+func (f *Facts) Rows() [][]string {
+	return [][]string{
+		{"hostname", f.Hostname},
+		{"os_id", f.OSID},
+		{"os_name", f.OSName},
+		{"os_version", f.OSVersion},
+		{"os_family", f.OSFamily},
+		{"kernel", f.Kernel},
+		{"architecture", f.Architecture},
+		{"cpus", strconv.Itoa(f.CPUs)},
+		{"memory_mb", strconv.Itoa(f.MemoryMB)},
+		{"ips", strings.Join(f.IPs, " ")},
+		{"package_manager", f.PackageManager},
+	}
+}
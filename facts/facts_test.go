@@ -0,0 +1,28 @@
+package facts_test
+
+import (
+	"testing"
+
+	"github.com/murdinc/crusher/facts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	f := facts.Parse("hostname=web01\nkernel=5.15.0-91-generic\narchitecture=x86_64\ncpus=8\nmemory_kb=16318480\nips=10.0.0.5 172.17.0.1\npackage_manager=apt-get\n--os-release--\nPRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\nID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\n")
+
+	assert.Equal(t, "web01", f.Hostname)
+	assert.Equal(t, "5.15.0-91-generic", f.Kernel)
+	assert.Equal(t, 8, f.CPUs)
+	assert.Equal(t, 15936, f.MemoryMB)
+	assert.Equal(t, "10.0.0.5", f.IP())
+	assert.Equal(t, "apt-get", f.PackageManager)
+	assert.Equal(t, "ubuntu", f.OSID)
+	assert.Equal(t, "22.04", f.OSVersion)
+	assert.Equal(t, "debian", f.OSFamily)
+	assert.Equal(t, 8, f.Vars()["fact.cpus"].Value)
+
+	// Missing facts are left empty
+	f = facts.Parse("hostname=web01\n")
+	assert.Equal(t, "", f.OSID)
+	assert.Equal(t, "", f.IP())
+}
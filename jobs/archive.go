@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/specr"
+)
+
+// Where archives downloaded on the host are kept, named by their sha256 sum
+const archiveCache = "/var/cache/crusher/archives"
+
+// Downloads and extracts the archives that the spec extracts on the host, skipping any that are
+// already deployed
+func (job *Job) extractArchives(family string) error {
+	for _, archive := range job.SpecList.HostArchives(job.SpecName, family) {
+		record := filepath.Join(specr.DeployedFolder, archive.SpecName)
+		if job.archiveDeployed(archive) {
+			job.emit(events.Event{Phase: events.FileTransfer, Step: archive.URL, Status: events.Unchanged, Message: "Unchanged archive: " + archive.URL})
+			continue
+		}
+
+		job.emit(events.Event{Phase: events.FileTransfer, Step: archive.URL, Status: events.Started, Message: "Extracting archive: " + archive.URL + " into " + archive.Destination})
+		start := time.Now()
+
+		if _, err := job.Executor.Run("sudo sh -c " + shellQuote(extractScript(archive))); err != nil {
+			job.fail(events.FileTransfer, archive.URL, "Unable to extract archive: "+archive.URL, err)
+			return err
+		}
+
+		if err := job.Executor.PutFile(strings.NewReader(archive.Record), record, PutOptions{}); err != nil {
+			job.fail(events.FileTransfer, record, "Unable to record archive: "+archive.URL, err)
+			return err
+		}
+
+		job.mu.Lock()
+		job.Changed = append(job.Changed, archive.Destination)
+		job.mu.Unlock()
+
+		job.emit(events.Event{Phase: events.FileTransfer, Step: archive.URL, Status: events.Updated, Message: "Extracted archive: " + archive.URL + " into " + archive.Destination, Duration: time.Since(start)})
+	}
+
+	return nil
+}
+
+// Checks if the host already has an archive extracted, from the record left by the last run
+func (job *Job) archiveDeployed(archive specr.HostArchive) bool {
+	current, err := job.Executor.Run("sudo cat " + shellQuote(filepath.Join(specr.DeployedFolder, archive.SpecName)))
+	return err == nil && strings.TrimSpace(current) == strings.TrimSpace(archive.Record)
+}
+
+// Returns a script that downloads an archive into the cache unless it is already there, checks
+// its sum and extracts it
+func extractScript(archive specr.HostArchive) string {
+	file := archiveCache + "/" + archive.SHA256 + "." + archive.Format
+	check := "echo " + shellQuote(archive.SHA256+"  ") + `"$1" | sha256sum -c --status`
+
+	script := []string{
+		"set -e",
+		"verify() { " + check + "; }",
+		"mkdir -p " + archiveCache,
+		"if ! verify " + file + " 2>/dev/null; then",
+		"  tmp=$(mktemp " + file + ".XXXXXXXX)",
+		`  trap 'rm -f "$tmp"' EXIT`,
+		"  if command -v curl >/dev/null; then curl -fsSL -o \"$tmp\" " + shellQuote(archive.URL) + "; else wget -q -O \"$tmp\" " + shellQuote(archive.URL) + "; fi",
+		`  verify "$tmp" || { echo "Downloaded archive does not match sha256 ` + archive.SHA256 + `" >&2; exit 1; }`,
+		`  mv -f "$tmp" ` + file,
+		"fi",
+		"mkdir -p " + shellQuote(archive.Destination),
+	}
+
+	if archive.Format == "zip" {
+		script = append(script, "unzip -o -q "+file+" -d "+shellQuote(archive.Destination))
+	} else {
+		script = append(script, "tar -xzf "+file+" --no-same-owner -C "+shellQuote(archive.Destination))
+	}
+
+	if archive.Chown != "" {
+		script = append(script, "chown -R "+shellQuote(archive.Chown)+" "+shellQuote(archive.Destination))
+	}
+
+	return strings.Join(script, "\n")
+}
+
+// Reports the archives that would be extracted on the host
+func (job *Job) planArchives(family string) {
+	for _, archive := range job.SpecList.HostArchives(job.SpecName, family) {
+		if job.archiveDeployed(archive) {
+			job.emit(events.Event{Phase: events.FileTransfer, Step: archive.URL, Status: events.Unchanged, Message: "Unchanged archive: " + archive.URL})
+			continue
+		}
+
+		job.Changed = append(job.Changed, archive.Destination)
+		job.emit(events.Event{Phase: events.FileTransfer, Step: archive.URL, Status: events.Info, Message: "Would extract archive: " + archive.URL + " into " + archive.Destination})
+	}
+}
@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/murdinc/crusher/events"
+)
+
+// Where the files replaced by each run are saved on the machine being configured
+const backupFolder = "/var/lib/crusher/backups"
+
+// Kinds of manifest entries
+const (
+	backedUp = "backup"  // The file existed, and a copy was saved
+	created  = "created" // The file did not exist before the run
+)
+
+// A file touched during a run, and how to undo it
+type backupEntry struct {
+	kind string
+	path string
+}
+
+// Format of run IDs
+const runIDFormat = "20060102-150405"
+
+// Returns an ID for a new run, these sort in the order the runs happened
+func NewRunID() string {
+	return time.Now().Format(runIDFormat)
+}
+
+// Checks that a run ID is one made by NewRunID, since it becomes part of a path
+func ValidateRunID(runID string) error {
+	if _, err := time.Parse(runIDFormat, runID); err != nil || len(runID) != len(runIDFormat) {
+		return fmt.Errorf("Invalid run ID [%s], expected the form %s", runID, runIDFormat)
+	}
+	return nil
+}
+
+// Returns the manifest line of an entry, with the path quoted so any file name survives
+func (entry backupEntry) String() string {
+	return entry.kind + " " + strconv.Quote(entry.path)
+}
+
+// Reads a manifest line
+func parseEntry(line string) (backupEntry, bool) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return backupEntry{}, false
+	}
+	// Manifests written before paths were quoted hold them as is
+	if !strings.HasPrefix(parts[1], `"`) {
+		return backupEntry{kind: parts[0], path: parts[1]}, true
+	}
+	path, err := strconv.Unquote(parts[1])
+	if err != nil {
+		return backupEntry{}, false
+	}
+	return backupEntry{kind: parts[0], path: path}, true
+}
+
+// Saves a copy of a file before it is replaced, and records it in the manifest of the run
+func (job *Job) backup(destination string) error {
+	runFolder := backupFolder + "/" + job.RunID
+	entry := backupEntry{kind: created, path: destination}
+
+	if _, err := job.Executor.Run("sudo test -e " + shellQuote(destination)); err == nil {
+		entry.kind = backedUp
+		if _, err := job.Executor.Run("sudo mkdir -p " + shellQuote(filepath.Dir(runFolder+destination))); err != nil {
+			return err
+		}
+		if _, err := job.Executor.Run("sudo cp -a " + shellQuote(destination) + " " + shellQuote(runFolder+destination)); err != nil {
+			return err
+		}
+	} else if _, err := job.Executor.Run("sudo mkdir -p " + shellQuote(runFolder)); err != nil {
+		return err
+	}
+
+	if _, err := job.Executor.Run("printf '%s\\n' " + shellQuote(entry.String()) + " | sudo tee -a " + shellQuote(runFolder+"/manifest") + " > /dev/null"); err != nil {
+		return err
+	}
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	if len(job.touched) == 0 {
+		job.emit(events.Event{Phase: events.FileTransfer, Step: runFolder, Status: events.Info, Message: "Backing up replaced files of run [" + job.RunID + "] to " + runFolder})
+	}
+
+	job.touched = append(job.touched, entry)
+	return nil
+}
+
+// Puts back every file touched by this run, after a later step failed
+func (job *Job) restore() {
+	job.emit(events.Event{Phase: events.Rollback, Status: events.Started, Message: "Rolling back the files changed by this run..."})
+
+	if err := job.restoreEntries(job.RunID, job.touched); err != nil {
+		job.fail(events.Rollback, "", "Rollback Failed! Previous files are saved in "+backupFolder+"/"+job.RunID, err)
+		return
+	}
+
+	job.emit(events.Event{Phase: events.Rollback, Status: events.Succeeded, Message: "Rollback Succeeded!"})
+}
+
+// Restores the files saved by a previous run, the latest one if runID is empty
+func (job *Job) Rollback(runID string) error {
+	job.Step = "Rollback"
+
+	if runID == "" {
+		out, err := job.Executor.Run("sudo ls -1 " + backupFolder + " | tail -n 1")
+		runID = strings.TrimSpace(out)
+		if err != nil || runID == "" {
+			err = fmt.Errorf("No runs found in %s", backupFolder)
+			job.fail(events.Rollback, "", "Nothing to roll back!", err)
+			return err
+		}
+	}
+
+	if err := ValidateRunID(runID); err != nil {
+		job.fail(events.Rollback, runID, "Unable to roll back!", err)
+		return err
+	}
+
+	job.emit(events.Event{Phase: events.Rollback, Step: runID, Status: events.Started, Message: "Rolling back run [" + runID + "]..."})
+
+	manifest, err := job.Executor.Run("sudo cat " + shellQuote(backupFolder+"/"+runID+"/manifest"))
+	if err != nil {
+		job.fail(events.Rollback, runID, "Unable to read the manifest of run ["+runID+"]", err)
+		return err
+	}
+
+	var entries []backupEntry
+	for _, line := range strings.Split(strings.TrimSpace(manifest), "\n") {
+		if entry, ok := parseEntry(line); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	if err := job.restoreEntries(runID, entries); err != nil {
+		job.fail(events.Rollback, runID, "Rollback of run ["+runID+"] Failed!", err)
+		return err
+	}
+
+	job.emit(events.Event{Phase: events.Rollback, Step: runID, Status: events.Succeeded, Message: fmt.Sprintf("Rolled back [%d] files from run [%s]!", len(entries), runID)})
+	return nil
+}
+
+// Undoes the entries in reverse order, so a file touched twice ends up as it was before the first time
+func (job *Job) restoreEntries(runID string, entries []backupEntry) error {
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+
+		cmd := "sudo rm -f " + shellQuote(entry.path)
+		if entry.kind == backedUp {
+			cmd = "sudo cp -a " + shellQuote(backupFolder+"/"+runID+entry.path) + " " + shellQuote(entry.path)
+		}
+
+		if _, err := job.Executor.Run(cmd); err != nil {
+			return err
+		}
+		job.emit(events.Event{Phase: events.Rollback, Step: entry.path, Status: events.Info, Message: "Restored file: " + entry.path})
+	}
+	return nil
+}
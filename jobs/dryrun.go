@@ -0,0 +1,130 @@
+package jobs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/specr"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Reports what Run would do without changing anything: the commands that would run, the packages
+// that are not installed yet, and a unified diff of every file that would change
+func (job *Job) plan() error {
+
+	job.Step = "Pre-Configuration"
+	for _, preCmd := range job.SpecList.PreCmds(job.SpecName) {
+		job.emit(events.Event{Phase: events.PreConfiguration, Step: preCmd, Status: events.Info, Message: "Would run Pre-Configuration Command: [" + preCmd + "]"})
+	}
+
+	job.Step = "Packages"
+	manager, err := job.packageManager()
+	if err != nil {
+		return err
+	}
+	job.Installed = job.missingPackages(manager)
+	for _, pkg := range job.Installed {
+		job.emit(events.Event{Phase: events.Packages, Step: pkg, Status: events.Info, Message: "Would install package: " + pkg})
+	}
+	for _, removeCmd := range job.removeCmds(manager) {
+		job.emit(events.Event{Phase: events.Packages, Step: removeCmd, Status: events.Info, Message: "Would run " + manager + " Command: [" + removeCmd + "]"})
+	}
+	if len(job.Installed) > 0 {
+		for _, pkgCmd := range job.SpecList.PackageCmds(job.SpecName, manager) {
+			job.emit(events.Event{Phase: events.Packages, Step: pkgCmd, Status: events.Info, Message: "Would run " + manager + " Command: [" + pkgCmd + "]"})
+		}
+	}
+
+	job.Step = "File Transfer"
+	if err := job.fetchContent(); err != nil {
+		return err
+	}
+	family, err := job.family()
+	if err != nil {
+		return err
+	}
+	fileList := job.SpecList.FileTransferList(job.SpecName, family)
+	for _, file := range *fileList {
+		if err := job.planFile(file); err != nil {
+			return err
+		}
+	}
+
+	job.planArchives(family)
+
+	stale, err := job.staleFiles(fileList, family)
+	if err != nil {
+		job.fail(events.FileTransfer, "", "Unable to list synced folders", err)
+		return err
+	}
+	for _, path := range stale {
+		job.Changed = append(job.Changed, path)
+		job.emit(events.Event{Phase: events.FileTransfer, Step: path, Status: events.Info, Message: "Would delete file: " + path})
+	}
+
+	job.Step = "Post-Configuration"
+	for _, postCmd := range job.SpecList.PostCmds(job.SpecName) {
+		job.emit(events.Event{Phase: events.PostConfiguration, Step: postCmd, Status: events.Info, Message: "Would run Post-Configuration Command: [" + postCmd + "]"})
+	}
+
+	job.Step = "Handlers"
+	for _, handler := range job.triggeredHandlers() {
+		job.emit(events.Event{Phase: events.Handlers, Step: handler.Command, Status: events.Info, Message: "Would run Handler [" + handler.Name + "]: [" + handler.Command + "]"})
+	}
+
+	return nil
+}
+
+// Renders a file and reports how it differs from the one in place
+func (job *Job) planFile(file specr.FileTransfer) error {
+	fileBytes, err := ioutil.ReadFile(file.Source)
+	if err != nil {
+		job.fail(events.FileTransfer, file.Destination, "Unable to read local file: "+file.Source, err)
+		return err
+	}
+
+	if file.Interpolate {
+		fileBytes, err = job.interpolate(fileBytes)
+		if err != nil {
+			job.fail(events.FileTransfer, file.Destination, "Unable to interpolate file: "+file.Source, err)
+			return err
+		}
+	}
+
+	if job.unchanged(checksum(fileBytes), file.Destination) {
+		job.emit(events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Unchanged, Message: "Unchanged file: " + file.Destination})
+		return nil
+	}
+
+	// Missing files diff against nothing
+	current, err := job.Executor.Run("sudo cat " + shellQuote(file.Destination))
+	from := file.Destination
+	if err != nil {
+		current = ""
+		from = "/dev/null"
+	}
+
+	job.Changed = append(job.Changed, file.Destination)
+	e := events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Info, Message: "Would update file: " + file.Destination}
+
+	if bytes.IndexByte(fileBytes, 0) >= 0 || strings.IndexByte(current, 0) >= 0 {
+		e.Diff = "Binary files " + from + " and " + file.Destination + " differ\n"
+	} else {
+		e.Diff, err = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(current),
+			B:        difflib.SplitLines(string(fileBytes)),
+			FromFile: from,
+			ToFile:   file.Destination,
+			Context:  3,
+		})
+		if err != nil {
+			job.fail(events.FileTransfer, file.Destination, "Unable to diff file: "+file.Destination, err)
+			return err
+		}
+	}
+
+	job.emit(e)
+	return nil
+}
@@ -0,0 +1,82 @@
+package jobs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Runs commands and places files on the machine being configured, so that the same job can run
+// locally or over ssh
+type Executor interface {
+	// Runs a shell command, returning its stdout. Failures are returned as a *CommandError
+	Run(command string) (string, error)
+
+	// Runs a shell command like Run, returning its stderr as well
+	RunOutput(command string) (stdout, stderr string, err error)
+
+	// Atomically writes the contents of src to the destination path as root, creating its folder if needed
+	PutFile(src io.Reader, destination string, opts PutOptions) error
+
+	// Returns information about a file, or an error satisfying os.IsNotExist if there is none
+	StatFile(path string) (os.FileInfo, error)
+
+	// Releases anything the executor holds open, and removes its staged files
+	Close() error
+}
+
+// Ownership of a file written by PutFile. When the file replaces an existing one, anything left
+// empty is kept from it, along with its SELinux context. New files belong to root, with mode 0644.
+type PutOptions struct {
+	Chown string // owner[:group]
+	Chmod string
+}
+
+// A failed command, along with its output
+type CommandError struct {
+	Err    error
+	Stdout string
+	Stderr string
+}
+
+func (c *CommandError) Error() string {
+	return c.Err.Error()
+}
+
+// Moves a file from the private staging folder to its destination as root. It is copied next to
+// the destination first and then renamed over it, so the destination is never partly written, and
+// new files get the SELinux context of the folder they are in rather than the staging folder.
+func placeFile(e Executor, staged, destination string, opts PutOptions) error {
+	dest := shellQuote(destination)
+	folder := filepath.Dir(destination)
+
+	// The temp file is only readable by root until its owner and mode are set
+	script := []string{
+		"set -e",
+		"mkdir -p " + shellQuote(folder),
+		"umask 077",
+		"tmp=$(mktemp " + shellQuote(filepath.Join(folder, "."+filepath.Base(destination)+".XXXXXXXX")) + ")",
+		"trap 'rm -f \"$tmp\"' EXIT",
+		"cp " + shellQuote(staged) + " \"$tmp\"",
+		"if [ -e " + dest + " ]; then chown \"$(stat -c %u:%g " + dest + ")\" \"$tmp\"; chmod \"$(stat -c %a " + dest + ")\" \"$tmp\"; chcon --reference=" + dest + " \"$tmp\" 2>/dev/null || true; else chmod 0644 \"$tmp\"; fi",
+	}
+	if opts.Chown != "" {
+		script = append(script, "chown "+shellQuote(opts.Chown)+" \"$tmp\"")
+	}
+	if opts.Chmod != "" {
+		script = append(script, "chmod "+shellQuote(opts.Chmod)+" \"$tmp\"")
+	}
+	script = append(script, "mv -f \"$tmp\" "+dest)
+
+	if _, err := e.Run("sudo sh -c " + shellQuote(strings.Join(script, "; "))); err != nil {
+		return fmt.Errorf("Unable to move file into place at [%s]: %s", destination, err)
+	}
+	return nil
+}
+
+// Quotes a string for use as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
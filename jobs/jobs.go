@@ -0,0 +1,286 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/facts"
+	"github.com/murdinc/crusher/specr"
+)
+
+// Configures a single machine with a spec, through an Executor
+type Job struct {
+	Server    string // Name of the server being configured, empty when configuring this machine
+	Host      string
+	Executor  Executor
+	SpecList  *specr.SpecList
+	SpecName  string
+	Vars      Vars
+	DryRun    bool   // Only report what would change
+	RunID     string // Where replaced files are backed up, see NewRunID
+	Events    chan events.Event
+	Step      string        // The step the job is on, or failed at
+	Changed   []string      // Destinations of the files that were written
+	Installed []string      // Packages that were not installed before the run
+	Distro    *specr.Distro // The distribution of the host, detected when the spec depends on it
+	Facts     *facts.Facts  // Gathered before the spec runs
+
+	Uploads int // Most files to upload at once, defaults to DefaultUploads and is capped at MaxUploads
+
+	mu      sync.Mutex // Guards Changed and touched while files upload
+	touched []backupEntry
+}
+
+// Files uploaded at once when Job.Uploads is not set
+const DefaultUploads = 4
+
+// Most files uploaded at once, each upload is an ssh session and sshd allows 10 by default
+const MaxUploads = 8
+
+// Template variables available to interpolated files
+type Vars struct {
+	Class    string
+	Sequence string
+	Locale   string
+}
+
+// Runs the pre-configuration commands, package manager commands, file transfers and post-configuration
+// commands of the spec, stopping at the first failure. Files changed before a failure are rolled back
+func (job *Job) Run() error {
+	// Templates can do without facts, so failing to gather them is not fatal
+	job.Step = "Facts"
+	if err := job.GatherFacts(); err != nil {
+		job.Facts = new(facts.Facts)
+		job.emit(events.Event{Phase: events.Facts, Status: events.Notice, Message: "Unable to gather facts: " + err.Error()})
+	}
+
+	if job.DryRun {
+		return job.plan()
+	}
+
+	if job.RunID == "" {
+		job.RunID = NewRunID()
+	}
+	if err := ValidateRunID(job.RunID); err != nil {
+		job.fail(events.Setup, "", "Unable to start the run!", err)
+		return err
+	}
+
+	err := job.run()
+	if err != nil && len(job.touched) > 0 {
+		job.restore()
+	}
+	return err
+}
+
+func (job *Job) run() error {
+
+	// Run pre configure commands
+	job.Step = "Pre-Configuration"
+	for _, preCmd := range job.SpecList.PreCmds(job.SpecName) {
+		if err := job.runCommand(events.PreConfiguration, "Pre-Configuration Command", preCmd); err != nil {
+			return err
+		}
+	}
+
+	// Run Package Manager Commands
+	job.Step = "Packages"
+	manager, err := job.packageManager()
+	if err != nil {
+		return err
+	}
+	missing := job.missingPackages(manager)
+	for _, pkgCmd := range append(job.removeCmds(manager), job.SpecList.PackageCmds(job.SpecName, manager)...) {
+		if err := job.runCommand(events.Packages, manager+" Command", pkgCmd); err != nil {
+			return err
+		}
+	}
+
+	job.Installed = missing
+
+	// Transfer any files we need to transfer
+	job.Step = "File Transfer"
+	if err := job.fetchContent(); err != nil {
+		return err
+	}
+	family, err := job.family()
+	if err != nil {
+		return err
+	}
+	fileList := job.SpecList.FileTransferList(job.SpecName, family)
+	if len(*fileList) > 0 || len(job.SpecList.SyncRoots(job.SpecName, family)) > 0 || len(job.SpecList.HostArchives(job.SpecName, family)) > 0 {
+		job.emit(events.Event{Phase: events.FileTransfer, Status: events.Started, Message: "Starting file transfer..."})
+		start := time.Now()
+		err := job.transferFiles(fileList)
+		if err == nil {
+			err = job.extractArchives(family)
+		}
+		if err == nil {
+			err = job.syncFolders(fileList, family)
+		}
+		if err != nil {
+			job.fail(events.FileTransfer, "", "File Transfer Failed! Aborting futher tasks for this server..", err)
+			return fmt.Errorf("File Transfer failed: %s", err)
+		}
+		job.emit(events.Event{Phase: events.FileTransfer, Status: events.Succeeded, Message: "File Transfer Succeeded!", Duration: time.Since(start)})
+	}
+
+	// Run post configure commands
+	job.Step = "Post-Configuration"
+	for _, postCmd := range job.SpecList.PostCmds(job.SpecName) {
+		if err := job.runCommand(events.PostConfiguration, "Post-Configuration Command", postCmd); err != nil {
+			return err
+		}
+	}
+
+	// Run the handlers of anything that changed
+	job.Step = "Handlers"
+	for _, handler := range job.triggeredHandlers() {
+		if err := job.runCommand(events.Handlers, "Handler ["+handler.Name+"]", handler.Command); err != nil {
+			return err
+		}
+	}
+
+	// End of the line
+	return nil
+}
+
+// Gathers the facts of the machine the job runs on
+func (job *Job) GatherFacts() error {
+	out, err := job.Executor.Run(facts.Command)
+	if err != nil {
+		return err
+	}
+
+	job.Facts = facts.Parse(out)
+	job.emit(events.Event{Phase: events.Facts, Status: events.Info, Message: fmt.Sprintf("Gathered facts: %s, %s, %d cpus, %d MB", job.Facts.Hostname, job.Facts.OSName, job.Facts.CPUs, job.Facts.MemoryMB)})
+	return nil
+}
+
+// Fetches the git and archive content of the spec, so its files can be listed
+func (job *Job) fetchContent() error {
+	if err := job.SpecList.FetchContent(job.SpecName); err != nil {
+		job.fail(events.FileTransfer, "", "Unable to fetch content! Aborting futher tasks for this server..", err)
+		return err
+	}
+	return nil
+}
+
+// Returns the handlers triggered by the files and packages that changed, each one only once
+func (job *Job) triggeredHandlers() []specr.Handler {
+	var triggered []specr.Handler
+	for _, handler := range job.SpecList.Handlers(job.SpecName) {
+		if handler.Triggered(job.Changed, job.Installed) {
+			triggered = append(triggered, handler)
+		}
+	}
+	return triggered
+}
+
+// Sends an event for this job
+func (job *Job) emit(e events.Event) {
+	e.Server = job.Server
+	e.Host = job.Host
+	e.Timestamp = time.Now()
+	job.Events <- e
+}
+
+// Sends a failed event for this job
+func (job *Job) fail(phase, step, message string, err error) {
+	job.emit(Failure(phase, step, message, err))
+}
+
+// Returns a failed event, with the output of the command if err is a *CommandError
+func Failure(phase, step, message string, err error) events.Event {
+	e := events.Event{Phase: phase, Step: step, Status: events.Failed, Message: message}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	if cmdErr, ok := err.(*CommandError); ok {
+		e.Stdout, e.Stderr = cmdErr.Stdout, cmdErr.Stderr
+	}
+	return e
+}
+
+// Runs a single command of the spec
+func (job *Job) runCommand(phase, name, cmd string) error {
+	job.emit(events.Event{Phase: phase, Step: cmd, Status: events.Started, Message: "Running " + name + ": [" + cmd + "]"})
+	start := time.Now()
+
+	stdout, stderr, err := job.Executor.RunOutput(cmd)
+	if err != nil {
+		job.fail(phase, cmd, name+": ["+cmd+"] Failed! Aborting futher tasks for this server..", err)
+		return fmt.Errorf("%s failed: %s", name, err)
+	}
+
+	job.emit(events.Event{Phase: phase, Step: cmd, Status: events.Succeeded, Message: name + ": [" + cmd + "] Succeeded!", Stdout: stdout, Stderr: stderr, Duration: time.Since(start)})
+	return nil
+}
+
+// Options for a local configuration run
+type LocalOptions struct {
+	Vars   Vars
+	DryRun bool   // Only report what would change
+	Output string // Output format, text or json
+}
+
+// Run Local configuration on this machine, returns an error if the job failed
+func LocalConfigure(specList *specr.SpecList, specName string, opts LocalOptions) error {
+
+	renderer, err := events.NewRenderer(opts.Output)
+	if err != nil {
+		return err
+	}
+
+	jobEvents := make(chan events.Event, 10)
+
+	job := &Job{
+		Executor: NewLocalExecutor(),
+		SpecList: specList,
+		SpecName: specName,
+		Vars:     opts.Vars,
+		DryRun:   opts.DryRun,
+		RunID:    NewRunID(),
+		Events:   jobEvents,
+	}
+	defer job.Executor.Close()
+
+	// Display Output of Job
+	rendered := events.Drain(jobEvents, renderer)
+
+	err = job.Run()
+
+	close(jobEvents)
+	<-rendered
+
+	return err
+}
+
+// Restores the files saved by a previous local run, the latest one if runID is empty
+func LocalRollback(runID, output string) error {
+
+	renderer, err := events.NewRenderer(output)
+	if err != nil {
+		return err
+	}
+
+	jobEvents := make(chan events.Event, 10)
+
+	job := &Job{
+		Executor: NewLocalExecutor(),
+		Events:   jobEvents,
+	}
+	defer job.Executor.Close()
+
+	// Display Output of Job
+	rendered := events.Drain(jobEvents, renderer)
+
+	err = job.Rollback(runID)
+
+	close(jobEvents)
+	<-rendered
+
+	return err
+}
@@ -0,0 +1,613 @@
+package jobs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/facts"
+	"github.com/murdinc/crusher/jobs"
+	"github.com/murdinc/crusher/specr"
+	"github.com/stretchr/testify/assert"
+)
+
+// Records what a job does instead of doing it
+type fakeExecutor struct {
+	sync.Mutex
+	commands []string
+	files    map[string]string
+	fail     string
+	found    string // What find lists in synced folders
+	release  string // The contents of /etc/os-release, in the facts
+	stdout   string // What spec commands print
+	stderr   string
+}
+
+func (f *fakeExecutor) Run(command string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	// Facts are gathered before every run, so they are left out of the commands
+	if command == facts.Command {
+		return "hostname=web01\ncpus=4\nmemory_kb=4194304\nips=10.0.0.5 10.0.1.5\n--os-release--\n" + f.release, nil
+	}
+
+	f.commands = append(f.commands, command)
+	if command == f.fail {
+		return "", &jobs.CommandError{Err: errors.New("exit status 1"), Stderr: "nope"}
+	}
+	if strings.Contains(command, "find ") {
+		return f.found, nil
+	}
+	if strings.HasPrefix(command, "sudo test -e ") {
+		if _, ok := f.files[unquote(strings.TrimPrefix(command, "sudo test -e "))]; !ok {
+			return "", &jobs.CommandError{Err: errors.New("exit status 1")}
+		}
+		return "", nil
+	}
+	if strings.HasPrefix(command, "sudo cat ") {
+		contents, ok := f.files[unquote(strings.TrimPrefix(command, "sudo cat "))]
+		if !ok {
+			return "", &jobs.CommandError{Err: errors.New("exit status 1")}
+		}
+		return contents, nil
+	}
+	if strings.HasPrefix(command, "sudo sha256sum ") {
+		contents, ok := f.files[unquote(strings.TrimPrefix(command, "sudo sha256sum "))]
+		if !ok {
+			return "", &jobs.CommandError{Err: errors.New("exit status 1")}
+		}
+		sum := sha256.Sum256([]byte(contents))
+		return hex.EncodeToString(sum[:]) + "  " + command, nil
+	}
+	return "", nil
+}
+
+// Reverses the single quoting commands put around paths
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '\'' || s[len(s)-1] != '\'' {
+		return s
+	}
+	return strings.Replace(s[1:len(s)-1], `'\''`, "'", -1)
+}
+
+func (f *fakeExecutor) RunOutput(command string) (string, string, error) {
+	out, err := f.Run(command)
+	if err != nil {
+		return out, "", err
+	}
+	if out == "" {
+		out = f.stdout
+	}
+	return out, f.stderr, nil
+}
+
+func (f *fakeExecutor) PutFile(src io.Reader, destination string, opts jobs.PutOptions) error {
+	f.Lock()
+	defer f.Unlock()
+
+	b, err := ioutil.ReadAll(src)
+	if opts.Chown != "" {
+		f.commands = append(f.commands, "sudo chown "+opts.Chown+" "+destination)
+	}
+	if opts.Chmod != "" {
+		f.commands = append(f.commands, "sudo chmod "+opts.Chmod+" "+destination)
+	}
+	f.files[destination] = string(b)
+	return err
+}
+
+func (f *fakeExecutor) StatFile(path string) (os.FileInfo, error) {
+	if path == "/etc" {
+		return nil, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (f *fakeExecutor) Close() error {
+	return nil
+}
+
+func runJob(spec *specr.Spec, executor *fakeExecutor) (*jobs.Job, error) {
+	jobEvents := make(chan events.Event, 100)
+	job := &jobs.Job{
+		Executor: executor,
+		SpecList: &specr.SpecList{Specs: map[string]*specr.Spec{"test": spec}},
+		SpecName: "test",
+		Vars:     jobs.Vars{Class: "web", Sequence: "1", Locale: "sfo"},
+		Events:   jobEvents,
+	}
+	err := job.Run()
+	close(jobEvents)
+	return job, err
+}
+
+func TestJobAbortsOnFailedCommand(t *testing.T) {
+	executor := &fakeExecutor{files: make(map[string]string), fail: "second"}
+	spec := &specr.Spec{Commands: specr.Commands{Post: []string{"first", "second", "third"}}}
+
+	job, err := runJob(spec, executor)
+
+	assert.Error(t, err)
+	assert.Equal(t, "Post-Configuration", job.Step)
+	assert.Equal(t, []string{"first", "second"}, executor.commands)
+}
+
+func TestJobEventsCarryOutput(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/app", 0755)
+	ioutil.WriteFile(root+"/configs/app/app.conf", []byte("listen 80"), 0644)
+
+	// Commands that succeed report what they printed
+	executor := &fakeExecutor{files: make(map[string]string), stdout: "migrated 3 tables\n", stderr: "warning: slow\n"}
+	spec := &specr.Spec{Commands: specr.Commands{Post: []string{"./migrate"}}}
+
+	jobEvents := make(chan events.Event, 100)
+	job := &jobs.Job{Executor: executor, SpecList: &specr.SpecList{Specs: map[string]*specr.Spec{"test": spec}}, SpecName: "test", Events: jobEvents}
+	assert.NoError(t, job.Run())
+	close(jobEvents)
+
+	var succeeded []events.Event
+	for e := range jobEvents {
+		if e.Step == "./migrate" && e.Status == events.Succeeded {
+			succeeded = append(succeeded, e)
+		}
+	}
+	assert.Len(t, succeeded, 1)
+	assert.Equal(t, "migrated 3 tables\n", succeeded[0].Stdout)
+	assert.Equal(t, "warning: slow\n", succeeded[0].Stderr)
+
+	// A failed transfer reports why
+	executor = &fakeExecutor{files: make(map[string]string), fail: "sudo mkdir -p -m '0750' '/etc/app'"}
+	spec = &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/", DirMode: "0750", SkipInterpolate: true}}
+
+	jobEvents = make(chan events.Event, 100)
+	job = &jobs.Job{Executor: executor, SpecList: &specr.SpecList{Specs: map[string]*specr.Spec{"test": spec}}, SpecName: "test", Events: jobEvents}
+	assert.Error(t, job.Run())
+	close(jobEvents)
+
+	var failed []events.Event
+	for e := range jobEvents {
+		if e.Phase == events.FileTransfer && e.Status == events.Failed && e.Step == "" {
+			failed = append(failed, e)
+		}
+	}
+	assert.Len(t, failed, 1)
+	assert.Contains(t, failed[0].Error, "exit status 1")
+	assert.Equal(t, "nope", failed[0].Stderr)
+}
+
+func TestJobInterpolatesFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/app", 0755)
+	ioutil.WriteFile(root+"/configs/app/app.conf", []byte("${var.class}-${var.sequence}.${var.locale} ${var.specname}"), 0644)
+
+	executor := &fakeExecutor{files: make(map[string]string)}
+	spec := &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/"}}
+
+	job, err := runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "web-1.sfo test", executor.files["/etc/app/app.conf"])
+	assert.Equal(t, []string{"/etc/app/app.conf"}, job.Changed)
+
+	// Nothing to do the second time around
+	job, err = runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Empty(t, job.Changed)
+}
+
+func TestJobSkipsUnchangedFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/my app", 0755)
+	ioutil.WriteFile(root+"/configs/my app/app.conf", []byte("listen 80"), 0644)
+
+	executor := &fakeExecutor{files: map[string]string{"/etc/my app/app.conf": "listen 80"}}
+	spec := &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/", SkipInterpolate: true}}
+
+	job, err := runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Contains(t, executor.commands, "sudo sha256sum '/etc/my app/app.conf'")
+	assert.Empty(t, job.Changed)
+}
+
+func TestJobSetsPermissions(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/app", 0755)
+	ioutil.WriteFile(root+"/configs/app/secret.conf", []byte("hunter2"), 0644)
+
+	executor := &fakeExecutor{files: make(map[string]string)}
+	spec := &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/", Owner: "app", Group: "app", Mode: "0600", DirMode: "0750"}}
+
+	_, err = runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Contains(t, executor.commands, "sudo mkdir -p -m '0750' '/etc/app'")
+	assert.Contains(t, executor.commands, "sudo chown 'app:app' '/etc/app'")
+	assert.Contains(t, executor.commands, "sudo chown app:app /etc/app/secret.conf")
+	assert.Contains(t, executor.commands, "sudo chmod 0600 /etc/app/secret.conf")
+	assert.NotContains(t, executor.commands, "sudo mkdir -p -m '0750' '/etc'")
+
+	// Unchanged files still get their owner and mode
+	executor.commands = nil
+	_, err = runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Contains(t, executor.commands, "sudo chown 'app:app' '/etc/app/secret.conf'")
+	assert.Contains(t, executor.commands, "sudo chmod '0600' '/etc/app/secret.conf'")
+}
+
+func TestJobDryRun(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/app", 0755)
+	ioutil.WriteFile(root+"/configs/app/app.conf", []byte("listen 80\nworkers 4\n"), 0644)
+
+	executor := &fakeExecutor{files: map[string]string{"/etc/app/app.conf": "listen 80\nworkers 2\n"}}
+	spec := &specr.Spec{
+		SpecRoot: root,
+		Configs:  specr.Configs{DebianRoot: "/etc/", SkipInterpolate: true},
+		Packages: specr.Packages{AptGet: []string{"nginx"}},
+		Commands: specr.Commands{Post: []string{"sudo service nginx reload"}},
+	}
+
+	jobEvents := make(chan events.Event, 100)
+	job := &jobs.Job{
+		Executor: executor,
+		SpecList: &specr.SpecList{Specs: map[string]*specr.Spec{"test": spec}},
+		SpecName: "test",
+		DryRun:   true,
+		Events:   jobEvents,
+	}
+	assert.NoError(t, job.Run())
+	close(jobEvents)
+
+	var diff string
+	for e := range jobEvents {
+		diff += e.Diff
+	}
+	assert.Contains(t, diff, "-workers 2")
+	assert.Contains(t, diff, "+workers 4")
+	assert.Contains(t, executor.commands, "sudo cat '/etc/app/app.conf'")
+
+	// Nothing was changed
+	assert.Equal(t, "listen 80\nworkers 2\n", executor.files["/etc/app/app.conf"])
+	for _, command := range executor.commands {
+		assert.NotContains(t, command, "apt-get")
+		assert.NotContains(t, command, "service")
+		assert.NotContains(t, command, "mv")
+	}
+}
+
+func TestJobRunsTriggeredHandlersOnce(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/nginx", 0755)
+	ioutil.WriteFile(root+"/configs/nginx/nginx.conf", []byte("worker_processes 4;"), 0644)
+
+	reload := specr.Handler{Name: "reload", Command: "sudo service nginx reload", Paths: []string{"/etc/nginx"}}
+	restart := specr.Handler{Name: "restart", Command: "sudo service php-fpm restart", Packages: []string{"php-fpm"}}
+
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{
+		"nginx": {SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/", SkipInterpolate: true}, Handlers: []specr.Handler{reload}},
+		"test":  {Requires: []string{"nginx"}, Handlers: []specr.Handler{reload, restart}},
+	}}
+
+	executor := &fakeExecutor{files: make(map[string]string)}
+	job := &jobs.Job{
+		Executor: executor,
+		SpecList: specList,
+		SpecName: "test",
+		Events:   make(chan events.Event, 100),
+	}
+
+	assert.NoError(t, job.Run())
+
+	reloads := 0
+	for _, command := range executor.commands {
+		if command == reload.Command {
+			reloads++
+		}
+		assert.NotEqual(t, restart.Command, command)
+	}
+	assert.Equal(t, 1, reloads)
+}
+
+func TestJobRollsBackAfterFailure(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/app", 0755)
+	ioutil.WriteFile(root+"/configs/app/app.conf", []byte("broken"), 0644)
+
+	executor := &fakeExecutor{files: map[string]string{"/etc/app/app.conf": "working"}, fail: "sudo service app restart"}
+	spec := &specr.Spec{
+		SpecRoot: root,
+		Configs:  specr.Configs{DebianRoot: "/etc/", SkipInterpolate: true},
+		Commands: specr.Commands{Post: []string{"sudo service app restart"}},
+	}
+
+	job := &jobs.Job{
+		Executor: executor,
+		SpecList: &specr.SpecList{Specs: map[string]*specr.Spec{"test": spec}},
+		SpecName: "test",
+		RunID:    "20170102-150405",
+		Events:   make(chan events.Event, 100),
+	}
+
+	assert.Error(t, job.Run())
+	assert.Contains(t, executor.commands, "sudo cp -a '/etc/app/app.conf' '/var/lib/crusher/backups/20170102-150405/etc/app/app.conf'")
+	assert.Equal(t, "sudo cp -a '/var/lib/crusher/backups/20170102-150405/etc/app/app.conf' '/etc/app/app.conf'", executor.commands[len(executor.commands)-1])
+}
+
+func TestJobBacksUpPathsWithSpaces(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/my app", 0755)
+	ioutil.WriteFile(root+"/configs/my app/app.conf", []byte("broken"), 0644)
+	ioutil.WriteFile(root+"/configs/my app/new.conf", []byte("new"), 0644)
+
+	executor := &fakeExecutor{files: map[string]string{"/etc/my app/app.conf": "working"}, fail: "sudo service app restart"}
+	spec := &specr.Spec{
+		SpecRoot: root,
+		Configs:  specr.Configs{DebianRoot: "/etc/", SkipInterpolate: true},
+		Commands: specr.Commands{Post: []string{"sudo service app restart"}},
+	}
+
+	job := &jobs.Job{
+		Executor: executor,
+		SpecList: &specr.SpecList{Specs: map[string]*specr.Spec{"test": spec}},
+		SpecName: "test",
+		RunID:    "20170102-150405",
+		Events:   make(chan events.Event, 100),
+	}
+
+	assert.Error(t, job.Run())
+	assert.Contains(t, executor.commands, "sudo cp -a '/etc/my app/app.conf' '/var/lib/crusher/backups/20170102-150405/etc/my app/app.conf'")
+	assert.Contains(t, executor.commands, `printf '%s\n' 'backup "/etc/my app/app.conf"' | sudo tee -a '/var/lib/crusher/backups/20170102-150405/manifest' > /dev/null`)
+	assert.Contains(t, executor.commands, `printf '%s\n' 'created "/etc/my app/new.conf"' | sudo tee -a '/var/lib/crusher/backups/20170102-150405/manifest' > /dev/null`)
+	assert.Contains(t, executor.commands, "sudo rm -f '/etc/my app/new.conf'")
+	assert.Contains(t, executor.commands, "sudo cp -a '/var/lib/crusher/backups/20170102-150405/etc/my app/app.conf' '/etc/my app/app.conf'")
+}
+
+func TestJobRollback(t *testing.T) {
+	executor := &fakeExecutor{files: map[string]string{
+		"/var/lib/crusher/backups/20170102-150405/manifest": "backup /etc/app/app.conf\ncreated /etc/app/extra.conf\n",
+	}}
+
+	job := &jobs.Job{
+		Executor: executor,
+		Events:   make(chan events.Event, 100),
+	}
+
+	assert.NoError(t, job.Rollback("20170102-150405"))
+	assert.Equal(t, []string{
+		"sudo cat '/var/lib/crusher/backups/20170102-150405/manifest'",
+		"sudo rm -f '/etc/app/extra.conf'",
+		"sudo cp -a '/var/lib/crusher/backups/20170102-150405/etc/app/app.conf' '/etc/app/app.conf'",
+	}, executor.commands)
+}
+
+func TestJobRollbackQuotedManifest(t *testing.T) {
+	executor := &fakeExecutor{files: map[string]string{
+		"/var/lib/crusher/backups/20170102-150405/manifest": "backup \"/etc/my app/it's.conf\"\ncreated \"/etc/my app/extra.conf\"\n",
+	}}
+
+	job := &jobs.Job{
+		Executor: executor,
+		Events:   make(chan events.Event, 100),
+	}
+
+	assert.NoError(t, job.Rollback("20170102-150405"))
+	assert.Equal(t, []string{
+		"sudo cat '/var/lib/crusher/backups/20170102-150405/manifest'",
+		"sudo rm -f '/etc/my app/extra.conf'",
+		"sudo cp -a '/var/lib/crusher/backups/20170102-150405/etc/my app/it'\\''s.conf' '/etc/my app/it'\\''s.conf'",
+	}, executor.commands)
+}
+
+func TestJobRollbackRejectsBadRunIDs(t *testing.T) {
+	for _, runID := range []string{"../../etc", "20170102-150405; rm -rf /", "2017-01-02"} {
+		executor := &fakeExecutor{files: make(map[string]string)}
+		job := &jobs.Job{
+			Executor: executor,
+			Events:   make(chan events.Event, 100),
+		}
+
+		assert.Error(t, job.Rollback(runID), runID)
+		assert.Empty(t, executor.commands, runID)
+	}
+}
+
+func TestJobUploadsManyFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/content", 0755)
+	for i := 0; i < 20; i++ {
+		ioutil.WriteFile(fmt.Sprintf("%s/content/%d.html", root, i), bytes.Repeat([]byte{byte(i)}, 1000*i), 0644)
+	}
+
+	executor := &fakeExecutor{files: make(map[string]string)}
+	spec := &specr.Spec{SpecRoot: root, Content: specr.Content{Source: "spec", DebianRoot: "/var/www/"}}
+
+	job, err := runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Len(t, job.Changed, 20)
+	assert.Equal(t, strings.Repeat("\x07", 7000), executor.files["/var/www/7.html"])
+}
+
+func TestJobSyncDeletesStaleFiles(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/content/css", 0755)
+	ioutil.WriteFile(root+"/content/index.html", []byte("<html>"), 0644)
+	ioutil.WriteFile(root+"/content/css/site.css", []byte("body {}"), 0644)
+
+	executor := &fakeExecutor{
+		files: make(map[string]string),
+		found: "/var/www/index.html\n/var/www/old.html\n/var/www/css/site.css\n/var/www/css/old.css\n/var/www/uploads/cat.jpg\n",
+	}
+	spec := &specr.Spec{SpecRoot: root, Content: specr.Content{Source: "spec", DebianRoot: "/var/www/", Sync: true, Exclude: []string{"uploads"}}}
+
+	job, err := runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Contains(t, executor.commands, "sudo rm -f '/var/www/old.html'")
+	assert.Contains(t, executor.commands, "sudo rm -f '/var/www/css/old.css'")
+	assert.NotContains(t, executor.commands, "sudo rm -f '/var/www/uploads/cat.jpg'")
+	assert.NotContains(t, executor.commands, "sudo rm -f '/var/www/index.html'")
+	assert.Contains(t, job.Changed, "/var/www/old.html")
+}
+
+func TestJobSyncHandlesSpacesInNames(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/content", 0755)
+	ioutil.WriteFile(root+"/content/my page.html", []byte("<html>"), 0644)
+
+	executor := &fakeExecutor{
+		files: map[string]string{"/var/www/old page.html": "<html>"},
+		found: "/var/www/my page.html\n/var/www/old page.html\n",
+	}
+	spec := &specr.Spec{SpecRoot: root, Content: specr.Content{Source: "spec", DebianRoot: "/var/www/", Sync: true}}
+
+	job, err := runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Contains(t, executor.commands, "sudo cp -a '/var/www/old page.html' '/var/lib/crusher/backups/"+job.RunID+"/var/www/old page.html'")
+	assert.Contains(t, executor.commands, "sudo rm -f '/var/www/old page.html'")
+	assert.NotContains(t, executor.commands, "sudo rm -f '/var/www/my page.html'")
+	assert.Equal(t, "<html>", executor.files["/var/www/my page.html"])
+	assert.Contains(t, job.Changed, "/var/www/old page.html")
+}
+
+func TestJobInstallsPackagesForTheDetectedDistro(t *testing.T) {
+	alpine := "NAME=\"Alpine Linux\"\nID=alpine\nVERSION_ID=3.18.4\nPRETTY_NAME=\"Alpine Linux v3.18\"\n"
+
+	// Only Debian packages
+	executor := &fakeExecutor{files: make(map[string]string), release: alpine}
+	spec := &specr.Spec{Packages: specr.Packages{AptGet: []string{"nginx"}}}
+	job, err := runJob(spec, executor)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "apk")
+	assert.Equal(t, "Packages", job.Step)
+
+	executor = &fakeExecutor{files: make(map[string]string), release: alpine}
+	spec = &specr.Spec{Packages: specr.Packages{AptGet: []string{"nginx"}, Apk: []string{"nginx", "curl"}}}
+	job, err = runJob(spec, executor)
+	assert.NoError(t, err)
+	assert.Equal(t, "apk", job.Distro.Manager)
+	assert.Contains(t, executor.commands, "sudo apk add nginx curl")
+	assert.Equal(t, []string{"nginx", "curl"}, job.Installed)
+	for _, command := range executor.commands {
+		assert.NotContains(t, command, "apt-get")
+	}
+}
+
+func TestJobTransfersFilesForTheDetectedFamily(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/debian/nginx", 0755)
+	os.MkdirAll(root+"/configs/default/nginx", 0755)
+	ioutil.WriteFile(root+"/configs/debian/nginx/site.conf", []byte("debian"), 0644)
+	ioutil.WriteFile(root+"/configs/default/nginx/site.conf", []byte("default"), 0644)
+
+	spec := &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/", RedHatRoot: "/opt/etc/", FamilyFolders: true, SkipInterpolate: true}}
+
+	// Red Hat hosts use their own root, and the default files
+	executor := &fakeExecutor{files: make(map[string]string), release: "ID=rocky\nID_LIKE=\"rhel fedora\"\nVERSION_ID=9.2\n"}
+	job, err := runJob(spec, executor)
+	assert.NoError(t, err)
+	assert.Equal(t, specr.RedHat, job.Distro.Family)
+	assert.Equal(t, map[string]string{"/opt/etc/nginx/site.conf": "default"}, executor.files)
+
+	executor = &fakeExecutor{files: make(map[string]string), release: "ID=debian\nVERSION_ID=12\n"}
+	_, err = runJob(spec, executor)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"/etc/nginx/site.conf": "debian"}, executor.files)
+
+	// Alpine has no root
+	executor = &fakeExecutor{files: make(map[string]string), release: "ID=alpine\n"}
+	_, err = runJob(spec, executor)
+	assert.NoError(t, err)
+	assert.Empty(t, executor.files)
+}
+
+func TestJobInterpolatesFacts(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	os.MkdirAll(root+"/configs/app", 0755)
+	ioutil.WriteFile(root+"/configs/app/app.conf", []byte("${fact.hostname} ${fact.ip} workers ${fact.cpus * 2}"), 0644)
+
+	executor := &fakeExecutor{files: make(map[string]string)}
+	spec := &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/"}}
+
+	job, err := runJob(spec, executor)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, job.Facts.CPUs)
+	assert.Equal(t, "web01 10.0.0.5 workers 8", executor.files["/etc/app/app.conf"])
+}
+
+func TestJobHandlesPinsAndRemovals(t *testing.T) {
+	executor := &fakeExecutor{files: make(map[string]string)}
+	spec := &specr.Spec{Packages: specr.Packages{AptGet: []string{"nginx=1.18.0-0ubuntu1"}, AptRemove: []string{"apache2"}}}
+
+	job, err := runJob(spec, executor)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"nginx"}, job.Installed)
+	assert.Contains(t, executor.commands, "sudo apt-get install -y -f --assume-yes --allow-downgrades nginx=1.18.0-0ubuntu1")
+	for _, command := range executor.commands {
+		// apache2 is not installed
+		assert.NotContains(t, command, "apt-get remove")
+	}
+
+	// Conflicts stop the job before anything is installed
+	executor = &fakeExecutor{files: make(map[string]string)}
+	spec = &specr.Spec{Packages: specr.Packages{AptGet: []string{"nginx"}, AptRemove: []string{"nginx"}}}
+	job, err = runJob(spec, executor)
+	assert.Error(t, err)
+	assert.Equal(t, "Packages", job.Step)
+	assert.Empty(t, executor.commands)
+}
@@ -0,0 +1,94 @@
+package jobs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Runs commands and places files on this machine
+type LocalExecutor struct {
+	staging string // Private folder files are staged in
+	staged  int
+	mu      sync.Mutex // Guards the above, files can be uploaded concurrently
+}
+
+func NewLocalExecutor() *LocalExecutor {
+	return new(LocalExecutor)
+}
+
+func (l *LocalExecutor) Run(command string) (string, error) {
+	stdout, _, err := l.RunOutput(command)
+	return stdout, err
+}
+
+func (l *LocalExecutor) RunOutput(command string) (string, string, error) {
+	cmd := exec.Command("sh", "-c", command)
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = &stdoutBuf
+	cmd.Stderr = &stderrBuf
+
+	if err := cmd.Run(); err != nil {
+		return stdoutBuf.String(), stderrBuf.String(), &CommandError{Err: err, Stdout: stdoutBuf.String(), Stderr: stderrBuf.String()}
+	}
+
+	return stdoutBuf.String(), stderrBuf.String(), nil
+}
+
+func (l *LocalExecutor) PutFile(src io.Reader, destination string, opts PutOptions) error {
+	staged, err := l.stagedPath()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(staged, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(staged)
+
+	_, err = io.Copy(f, src)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return placeFile(l, staged, destination, opts)
+}
+
+// Returns a new path in the staging folder, making the folder the first time
+func (l *LocalExecutor) stagedPath() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.staging == "" {
+		// Only readable by us
+		staging, err := ioutil.TempDir("", "crusher")
+		if err != nil {
+			return "", err
+		}
+		l.staging = staging
+	}
+
+	l.staged++
+	return filepath.Join(l.staging, strconv.Itoa(l.staged)), nil
+}
+
+func (l *LocalExecutor) StatFile(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (l *LocalExecutor) Close() error {
+	if l.staging != "" {
+		return os.RemoveAll(l.staging)
+	}
+	return nil
+}
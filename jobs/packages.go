@@ -0,0 +1,169 @@
+package jobs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/facts"
+	"github.com/murdinc/crusher/specr"
+)
+
+// Detects the distribution of the host from its facts the first time it is needed. Hosts without
+// an /etc/os-release are assumed to be Debian
+func (job *Job) detect(phase string) error {
+	if job.Distro != nil {
+		return nil
+	}
+
+	if job.Facts == nil {
+		if err := job.GatherFacts(); err != nil {
+			job.Facts = new(facts.Facts)
+		}
+	}
+	distro, parseErr := specr.ParseOSRelease(job.Facts.Release)
+
+	switch {
+	case strings.TrimSpace(job.Facts.Release) == "":
+		distro = specr.Distro{ID: "debian", Name: "debian", Family: specr.Debian, Manager: specr.AptGet}
+		job.emit(events.Event{Phase: phase, Status: events.Notice, Message: "Unable to read /etc/os-release, assuming Debian"})
+	case parseErr != nil:
+		job.fail(phase, "", "Unable to detect the distribution of this server", parseErr)
+		return parseErr
+	default:
+		job.emit(events.Event{Phase: phase, Status: events.Info, Message: "Detected " + distro.Name + " (" + distro.Family + " family)"})
+	}
+
+	job.Distro = &distro
+	return nil
+}
+
+// Returns the family of the host, only detecting it when the files of the spec depend on it
+func (job *Job) family() (string, error) {
+	if job.Distro == nil && !job.SpecList.FamilySpecific(job.SpecName) {
+		return specr.Debian, nil
+	}
+	if err := job.detect(events.FileTransfer); err != nil {
+		return "", err
+	}
+	return job.Distro.Family, nil
+}
+
+// Returns the package manager of the host, or an empty string when the spec has no packages
+func (job *Job) packageManager() (string, error) {
+	if !job.SpecList.HasPackages(job.SpecName) {
+		return "", nil
+	}
+
+	if err := job.detect(events.Packages); err != nil {
+		return "", err
+	}
+
+	manager := job.Distro.Manager
+	if specs := job.SpecList.SpecsWithoutPackages(job.SpecName, manager); len(specs) > 0 {
+		err := fmt.Errorf("Spec [%s] has no packages for %s, add a [PACKAGES] %s key", strings.Join(specs, ", "), job.Distro.Name, strings.Replace(manager, "-", "_", -1))
+		job.fail(events.Packages, "", "No packages for the "+job.Distro.Family+" family! Aborting futher tasks for this server..", err)
+		return "", err
+	}
+
+	if manager == specr.AptGet {
+		if _, err := job.SpecList.AptPlan(job.SpecName); err != nil {
+			job.fail(events.Packages, "", "Conflicting packages! Aborting futher tasks for this server..", err)
+			return "", err
+		}
+	}
+
+	return manager, nil
+}
+
+// Returns the packages of the spec that the package manager does not have installed yet
+func (job *Job) missingPackages(manager string) []string {
+	if manager == specr.AptGet {
+		return job.missingAptPackages()
+	}
+
+	packages := job.SpecList.Packages(job.SpecName, manager)
+	if len(packages) == 0 {
+		return nil
+	}
+
+	// The queries fail if any package is missing, but still list the rest
+	query := map[string]string{
+		specr.Dnf:    "rpm -q --qf '%{NAME}\\n' ",
+		specr.Yum:    "rpm -q --qf '%{NAME}\\n' ",
+		specr.Zypper: "rpm -q --qf '%{NAME}\\n' ",
+		specr.Apk:    "apk info -e ",
+		specr.Pacman: "pacman -Q ",
+	}[manager]
+	out, _ := job.Executor.Run(query + strings.Join(packages, " "))
+
+	installed := make(map[string]bool)
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			installed[fields[0]] = true
+		}
+	}
+
+	var missing []string
+	for _, pkg := range packages {
+		if !installed[pkg] {
+			missing = append(missing, pkg)
+		}
+	}
+	return missing
+}
+
+// Returns the apt packages of the spec that are not installed, or not at their pinned version
+func (job *Job) missingAptPackages() []string {
+	plan, _ := job.SpecList.AptPlan(job.SpecName)
+
+	var names []string
+	for _, pkg := range plan.Install {
+		names = append(names, strings.SplitN(pkg, "=", 2)[0])
+	}
+	versions := job.dpkgVersions(names)
+
+	var missing []string
+	for _, name := range names {
+		version, ok := versions[name]
+		if pin := plan.Pins[name]; !ok || pin != "" && pin != version {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Returns the commands that remove the apt packages the spec wants gone, for those that are installed
+func (job *Job) removeCmds(manager string) []string {
+	if manager != specr.AptGet {
+		return nil
+	}
+
+	plan, _ := job.SpecList.AptPlan(job.SpecName)
+	if len(plan.Remove)+len(plan.Purge) == 0 {
+		return nil
+	}
+
+	installed := make(map[string]bool)
+	for name := range job.dpkgVersions(append(append([]string{}, plan.Remove...), plan.Purge...)) {
+		installed[name] = true
+	}
+	return plan.RemoveCmds(installed)
+}
+
+// Returns the installed versions of packages, keyed by name
+func (job *Job) dpkgVersions(names []string) map[string]string {
+	versions := make(map[string]string)
+	if len(names) == 0 {
+		return versions
+	}
+
+	// dpkg-query fails if any package is unknown, but still lists the rest
+	out, _ := job.Executor.Run("dpkg-query -W -f='${Package} ${Status} ${Version}\\n' " + strings.Join(names, " "))
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 5 && fields[3] == "installed" {
+			versions[fields[0]] = fields[4]
+		}
+	}
+	return versions
+}
@@ -0,0 +1,150 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Runs commands and places files on a remote server over an ssh client. It is safe for concurrent use
+type SSHExecutor struct {
+	client         *ssh.Client
+	sftpClient     *sftp.Client
+	commandTimeout time.Duration
+	staging        string // Private folder files are staged in
+	staged         int
+	mu             sync.Mutex // Guards the above, files can be uploaded concurrently
+}
+
+// Returns an executor for an open ssh client, commands are killed once they run for longer than
+// commandTimeout, unless it is 0
+func NewSSHExecutor(client *ssh.Client, commandTimeout time.Duration) *SSHExecutor {
+	return &SSHExecutor{client: client, commandTimeout: commandTimeout}
+}
+
+func (s *SSHExecutor) Run(cmd string) (string, error) {
+	stdout, _, err := s.RunOutput(cmd)
+	return stdout, err
+}
+
+func (s *SSHExecutor) RunOutput(cmd string) (string, string, error) {
+
+	// Open an ssh session
+	session, err := s.client.NewSession()
+	if err != nil {
+		return "", "", err
+	}
+	defer session.Close()
+
+	var stdoutBuf, stderrBuf bytes.Buffer
+	session.Stdout = &stdoutBuf
+	session.Stderr = &stderrBuf
+
+	// Kill the command if it runs for too long
+	var timer *time.Timer
+	if s.commandTimeout > 0 {
+		timer = time.AfterFunc(s.commandTimeout, func() {
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+		})
+	}
+
+	err = session.Run(cmd)
+
+	if timer != nil && !timer.Stop() {
+		err = fmt.Errorf("Command [%s] timed out after %s", cmd, s.commandTimeout)
+	}
+
+	if err != nil {
+		return stdoutBuf.String(), stderrBuf.String(), &CommandError{Err: err, Stdout: stdoutBuf.String(), Stderr: stderrBuf.String()}
+	}
+
+	return stdoutBuf.String(), stderrBuf.String(), nil
+}
+
+func (s *SSHExecutor) PutFile(src io.Reader, destination string, opts PutOptions) error {
+	sftpClient, err := s.sftp()
+	if err != nil {
+		return err
+	}
+
+	staged, err := s.stagedPath()
+	if err != nil {
+		return err
+	}
+
+	rf, err := sftpClient.OpenFile(staged, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	defer sftpClient.Remove(staged)
+
+	_, err = io.Copy(rf, src)
+	if closeErr := rf.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return placeFile(s, staged, destination, opts)
+}
+
+func (s *SSHExecutor) StatFile(path string) (os.FileInfo, error) {
+	sftpClient, err := s.sftp()
+	if err != nil {
+		return nil, err
+	}
+	return sftpClient.Stat(path)
+}
+
+func (s *SSHExecutor) Close() error {
+	if s.staging != "" {
+		s.Run("rm -rf " + shellQuote(s.staging))
+	}
+	if s.sftpClient != nil {
+		return s.sftpClient.Close()
+	}
+	return nil
+}
+
+// Returns a new path in the staging folder, making the folder the first time
+func (s *SSHExecutor) stagedPath() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.staging == "" {
+		// mktemp makes the folder only readable by us
+		out, err := s.Run("mktemp -d /tmp/crusher.XXXXXXXX")
+		if err != nil {
+			return "", fmt.Errorf("Unable to make staging folder: %s", err)
+		}
+		s.staging = strings.TrimSpace(out)
+	}
+
+	s.staged++
+	return s.staging + "/" + strconv.Itoa(s.staged), nil
+}
+
+// Opens the sftp session the first time it is needed
+func (s *SSHExecutor) sftp() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sftpClient == nil {
+		sftpClient, err := sftp.NewClient(s.client)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to open sftp session: %s", err)
+		}
+		s.sftpClient = sftpClient
+	}
+	return s.sftpClient, nil
+}
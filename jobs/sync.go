@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/specr"
+)
+
+// Deletes the files under synced folders that the spec does not transfer, backing them up first
+func (job *Job) syncFolders(fileList *specr.FileTransfers, family string) error {
+	stale, err := job.staleFiles(fileList, family)
+	if err != nil {
+		job.fail(events.FileTransfer, "", "Unable to list synced folders", err)
+		return err
+	}
+
+	for _, path := range stale {
+		if err := job.backup(path); err != nil {
+			job.fail(events.FileTransfer, path, "Unable to back up file: "+path, err)
+			return err
+		}
+
+		if _, err := job.Executor.Run("sudo rm -f " + shellQuote(path)); err != nil {
+			job.fail(events.FileTransfer, path, "Unable to delete file: "+path, err)
+			return err
+		}
+
+		job.mu.Lock()
+		job.Changed = append(job.Changed, path)
+		job.mu.Unlock()
+
+		job.emit(events.Event{Phase: events.FileTransfer, Step: path, Status: events.Deleted, Message: "Deleted file: " + path})
+	}
+
+	return nil
+}
+
+// Returns the files under the synced folders of the spec that are neither transferred nor excluded
+func (job *Job) staleFiles(fileList *specr.FileTransfers, family string) ([]string, error) {
+	wanted := make(map[string]bool)
+	for _, file := range *fileList {
+		wanted[filepath.Clean(file.Destination)] = true
+	}
+
+	stale := make(map[string]bool)
+	for _, root := range job.SpecList.SyncRoots(job.SpecName, family) {
+		folder := shellQuote(root.Destination)
+		out, err := job.Executor.Run("sudo sh -c " + shellQuote("if [ -d "+folder+" ]; then find "+folder+" ! -type d; fi"))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, path := range strings.Split(out, "\n") {
+			if path == "" {
+				continue
+			}
+			path = filepath.Clean(path)
+			if !wanted[path] && !root.Excluded(path) {
+				stale[path] = true
+			}
+		}
+	}
+
+	var paths []string
+	for path := range stale {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
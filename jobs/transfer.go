@@ -0,0 +1,315 @@
+package jobs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hil"
+	"github.com/hashicorp/hil/ast"
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/specr"
+)
+
+// How often the progress of an upload is reported
+var progressInterval = time.Second * 2
+
+// Transfers the files, job.Uploads at a time. Once one fails no more are started, and the
+// first error is returned after the ones in flight finish
+func (job *Job) transferFiles(fileList *specr.FileTransfers) error {
+	uploads := job.Uploads
+	if uploads <= 0 {
+		uploads = DefaultUploads
+	}
+	if uploads > MaxUploads {
+		uploads = MaxUploads
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	slots := make(chan struct{}, uploads)
+
+	for _, file := range *fileList {
+
+		slots <- struct{}{}
+
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func(file specr.FileTransfer) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := job.transferFile(file); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(file)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// Transfers a single file, unless the destination already matches
+func (job *Job) transferFile(file specr.FileTransfer) error {
+
+	job.emit(events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Started, Message: "Transferring file: " + file.Destination})
+
+	if !file.Interpolate {
+		job.emit(events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Notice, Message: "Skipping Interpolation on file: " + file.Destination})
+	}
+
+	// Open the local file
+	////////////////..........
+	content, err := job.render(file)
+	if err != nil {
+		job.fail(events.FileTransfer, file.Destination, "Unable to read local file: "+file.Source, err)
+		return err
+	}
+	defer content.Close()
+
+	// Skip files that already match
+	////////////////..........
+	if job.unchanged(content.sum, file.Destination) {
+		if err := job.setPermissions(file); err != nil {
+			job.fail(events.FileTransfer, file.Destination, "Unable to set permissions of file: "+file.Destination, err)
+			return err
+		}
+		job.emit(events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Unchanged, Message: "Unchanged file: " + file.Destination})
+		return nil
+	}
+
+	// Write the file
+	////////////////..........
+	if err := job.backup(file.Destination); err != nil {
+		job.fail(events.FileTransfer, file.Destination, "Unable to back up file: "+file.Destination, err)
+		return err
+	}
+
+	if err := job.makeFolders(file); err != nil {
+		job.fail(events.FileTransfer, file.Destination, "Unable to make directory: "+file.Folder, err)
+		return err
+	}
+
+	start := time.Now()
+	progress := &progressReader{reader: content, size: content.size, last: start, report: func(read, size int64) {
+		job.emit(events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Info,
+			Message: fmt.Sprintf("Uploading file: %s [%d%%] (%s of %s)", file.Destination, read*100/size, byteSize(read), byteSize(size))})
+	}}
+
+	if err := job.Executor.PutFile(progress, file.Destination, PutOptions{Chown: file.Chown, Chmod: file.Chmod}); err != nil {
+		job.fail(events.FileTransfer, file.Destination, "Unable to write file: "+file.Destination, err)
+		return err
+	}
+
+	job.mu.Lock()
+	job.Changed = append(job.Changed, file.Destination)
+	job.mu.Unlock()
+
+	job.emit(events.Event{Phase: events.FileTransfer, Step: file.Destination, Status: events.Updated, Message: "Updated file: " + file.Destination, Duration: time.Since(start)})
+	return nil
+}
+
+// The contents of a file as it will be written, along with their size and sha256 sum
+type renderedFile struct {
+	io.Reader
+	io.Closer
+	size int64
+	sum  string
+}
+
+// Opens a file for transfer. Interpolated files are rendered in memory, the rest are streamed
+// from disk so large content files are never read in whole.
+func (job *Job) render(file specr.FileTransfer) (*renderedFile, error) {
+	if file.Interpolate {
+		fileBytes, err := ioutil.ReadFile(file.Source)
+		if err != nil {
+			return nil, err
+		}
+		fileBytes, err = job.interpolate(fileBytes)
+		if err != nil {
+			return nil, err
+		}
+		return &renderedFile{Reader: bytes.NewReader(fileBytes), Closer: ioutil.NopCloser(nil), size: int64(len(fileBytes)), sum: checksum(fileBytes)}, nil
+	}
+
+	f, err := os.Open(file.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &renderedFile{Reader: f, Closer: f, size: size, sum: hex.EncodeToString(hash.Sum(nil))}, nil
+}
+
+// Returns the hex encoded sha256 sum of some bytes
+func checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Reports how much of a file has been read, at most once every progressInterval
+type progressReader struct {
+	reader io.Reader
+	read   int64
+	size   int64
+	last   time.Time
+	report func(read, size int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	p.read += int64(n)
+	if p.size > 0 && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.report(p.read, p.size)
+	}
+	return n, err
+}
+
+// Formats a number of bytes for people
+func byteSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// Checks if the file at the destination already has the given sha256 sum. Files that are
+// missing or unreadable count as changed
+func (job *Job) unchanged(sum string, destination string) bool {
+	out, err := job.Executor.Run("sudo sha256sum " + shellQuote(destination))
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(out)
+	return len(fields) > 0 && fields[0] == sum
+}
+
+// Creates any missing folders above a file, with the owner and folder mode of the file
+func (job *Job) makeFolders(file specr.FileTransfer) error {
+	if file.Chown == "" && file.DirChmod == "" {
+		return nil // left to the executor
+	}
+
+	var missing []string
+	for folder := file.Folder; folder != "/" && folder != "."; folder = filepath.Dir(folder) {
+		if _, err := job.Executor.StatFile(folder); !os.IsNotExist(err) {
+			break
+		}
+		missing = append([]string{folder}, missing...)
+	}
+
+	for _, folder := range missing {
+		mkdir := "sudo mkdir -p " + shellQuote(folder)
+		if file.DirChmod != "" {
+			mkdir = "sudo mkdir -p -m " + shellQuote(file.DirChmod) + " " + shellQuote(folder)
+		}
+		if _, err := job.Executor.Run(mkdir); err != nil {
+			return err
+		}
+		if file.Chown != "" {
+			if _, err := job.Executor.Run("sudo chown " + shellQuote(file.Chown) + " " + shellQuote(folder)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Applies the owner and mode of a file that is already in place
+func (job *Job) setPermissions(file specr.FileTransfer) error {
+	if file.Chown != "" {
+		if _, err := job.Executor.Run("sudo chown " + shellQuote(file.Chown) + " " + shellQuote(file.Destination)); err != nil {
+			return err
+		}
+	}
+	if file.Chmod != "" {
+		if _, err := job.Executor.Run("sudo chmod " + shellQuote(file.Chmod) + " " + shellQuote(file.Destination)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluates the HIL template in a file
+func (job *Job) interpolate(fileBytes []byte) ([]byte, error) {
+	tree, err := hil.Parse(string(fileBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]ast.Variable{
+		"var.class": ast.Variable{
+			Type:  ast.TypeString,
+			Value: job.Vars.Class,
+		},
+		"var.sequence": ast.Variable{
+			Type:  ast.TypeString,
+			Value: job.Vars.Sequence,
+		},
+		"var.locale": ast.Variable{
+			Type:  ast.TypeString,
+			Value: job.Vars.Locale,
+		},
+		"var.specname": ast.Variable{
+			Type:  ast.TypeString,
+			Value: job.SpecName,
+		},
+	}
+
+	// Facts are only missing when the job was not started with Run
+	if job.Facts != nil {
+		for name, v := range job.Facts.Vars() {
+			vars[name] = v
+		}
+	}
+
+	config := &hil.EvalConfig{
+		GlobalScope: &ast.BasicScope{VarMap: vars},
+	}
+
+	result, err := hil.Eval(tree, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(result.Value.(string)), nil
+}
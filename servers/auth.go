@@ -0,0 +1,134 @@
+package servers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Keys we look for when a server has no IdentityFile configured
+var defaultIdentityFiles = []string{
+	"~/.ssh/id_ed25519",
+	"~/.ssh/id_ecdsa",
+	"~/.ssh/id_rsa",
+}
+
+// Holds the ssh-agent connection and any private keys we have already loaded, so
+// that we only ask for each passphrase once per run
+type keyChain struct {
+	agent   agent.Agent
+	signers map[string]ssh.Signer
+}
+
+// Connects to the ssh-agent if SSH_AUTH_SOCK is set, and returns an empty keyChain
+func newKeyChain() *keyChain {
+	k := &keyChain{signers: make(map[string]ssh.Signer)}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		conn, err := net.Dial("unix", sock)
+		if err == nil {
+			k.agent = agent.NewClient(conn)
+		}
+	}
+
+	return k
+}
+
+// Returns the auth methods for a server, in the order they should be tried:
+// ssh-agent, private key files, and then password auth
+func (k *keyChain) authMethods(server Server) ([]ssh.AuthMethod, error) {
+	var methods []ssh.AuthMethod
+
+	var signers []ssh.Signer
+	if server.IdentityFile != "" {
+		signer, err := k.loadKey(server.IdentityFile, true)
+		if err != nil {
+			return nil, err
+		}
+		signers = append(signers, signer)
+	} else {
+		// Only bother the user for passphrases of default keys if there is no agent to fall back on
+		for _, file := range defaultIdentityFiles {
+			signer, err := k.loadKey(file, k.agent == nil)
+			if err == nil {
+				signers = append(signers, signer)
+			}
+		}
+	}
+
+	// The client only tries each method name once, so agent and file keys share one publickey method
+	if k.agent != nil || len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			if k.agent == nil {
+				return signers, nil
+			}
+			agentSigners, err := k.agent.Signers()
+			if err != nil {
+				return signers, nil
+			}
+			return append(agentSigners, signers...), nil
+		}))
+	}
+
+	if server.PassAuth {
+		methods = append(methods, ssh.Password(server.Password))
+	}
+
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("No ssh-agent, private key or password available for server [%s]", server.Name)
+	}
+
+	return methods, nil
+}
+
+// Reads and parses a private key, prompting for the passphrase if it is encrypted and prompt is true
+func (k *keyChain) loadKey(file string, prompt bool) (ssh.Signer, error) {
+	file = expandHome(file)
+
+	if signer, ok := k.signers[file]; ok {
+		return signer, nil
+	}
+
+	keyBytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read private key [%s]: %s", file, err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if _, encrypted := err.(*ssh.PassphraseMissingError); encrypted {
+		if !prompt {
+			return nil, err
+		}
+		passphrase, ok := os.LookupEnv(KeyPassphraseEnv)
+		if !ok {
+			passphrase, err = promptPassword(fmt.Sprintf("Please enter the passphrase for private key [%s]:", file))
+			if err != nil {
+				return nil, err
+			}
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyBytes, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse private key [%s]: %s", file, err)
+	}
+
+	k.signers[file] = signer
+	return signer, nil
+}
+
+// Expands a leading ~/ to the current users home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		currentUser, err := user.Current()
+		if err == nil {
+			return currentUser.HomeDir + path[1:]
+		}
+	}
+	return path
+}
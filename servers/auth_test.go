@@ -0,0 +1,221 @@
+package servers_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/murdinc/crusher/servers"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Writes a new rsa private key to file, encrypted when passphrase is not empty
+func writeKey(t *testing.T, file, passphrase string) ssh.PublicKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	if passphrase != "" {
+		block, err = x509.EncryptPEMBlock(rand.Reader, block.Type, block.Bytes, []byte(passphrase), x509.PEMCipherAES256)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(block), 0600))
+
+	public, err := ssh.NewPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	return public
+}
+
+// Serves an ssh-agent holding a new key on a socket in folder, returning its public key
+func serveAgent(t *testing.T, folder string) (ssh.PublicKey, net.Listener) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	keyring := agent.NewKeyring()
+	assert.NoError(t, keyring.Add(agent.AddedKey{PrivateKey: private}))
+
+	listener, err := net.Listen("unix", folder+"/agent.sock")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	sshKey, err := ssh.NewPublicKey(public)
+	assert.NoError(t, err)
+	return sshKey, listener
+}
+
+var errDenied = errors.New("denied")
+
+// An ssh server that records the auth attempts of clients, accepting one key and one password
+type authServer struct {
+	sync.Mutex
+	net.Listener
+	attempts []string // Fingerprints of the keys tried, or password
+}
+
+func serveAuth(t *testing.T, key ssh.PublicKey, password string) *authServer {
+	server := new(authServer)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, offered ssh.PublicKey) (*ssh.Permissions, error) {
+			server.Lock()
+			defer server.Unlock()
+			server.attempts = append(server.attempts, ssh.FingerprintSHA256(offered))
+			if key != nil && string(offered.Marshal()) == string(key.Marshal()) {
+				return nil, nil
+			}
+			return nil, errDenied
+		},
+		PasswordCallback: func(conn ssh.ConnMetadata, offered []byte) (*ssh.Permissions, error) {
+			server.Lock()
+			defer server.Unlock()
+			server.attempts = append(server.attempts, "password")
+			if password != "" && string(offered) == password {
+				return nil, nil
+			}
+			return nil, errDenied
+		},
+	}
+	config.AddHostKey(newHostKey(t, "ed25519"))
+
+	var err error
+	server.Listener, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if sshConn, chans, reqs, err := ssh.NewServerConn(conn, config); err == nil {
+					go ssh.DiscardRequests(reqs)
+					for ch := range chans {
+						ch.Reject(ssh.Prohibited, "auth only")
+					}
+					sshConn.Close()
+				}
+			}()
+		}
+	}()
+
+	return server
+}
+
+// Logs in to the server with the auth methods, returning what was tried
+func (a *authServer) login(methods []ssh.AuthMethod) ([]string, error) {
+	client, err := ssh.Dial("tcp", a.Addr().String(), &ssh.ClientConfig{User: "deploy", Auth: methods, HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	if err == nil {
+		client.Close()
+	}
+
+	a.Lock()
+	defer a.Unlock()
+	return a.attempts, err
+}
+
+func TestAuthMethodOrder(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	defer setInteractive(false)()
+
+	agentKey, agentListener := serveAgent(t, tmp)
+	defer agentListener.Close()
+	sock := tmp + "/agent.sock"
+	defer setEnv("SSH_AUTH_SOCK", &sock)()
+
+	fileKey := writeKey(t, tmp+"/id_rsa", "")
+	server := servers.Server{Name: "web", Username: "deploy", PassAuth: true, Password: "secret"}
+
+	// The agent, then the default keys that exist, then the password
+	methods, err := servers.AuthMethods(server, tmp+"/id_ed25519", tmp+"/id_rsa")
+	assert.NoError(t, err)
+
+	sshServer := serveAuth(t, nil, "secret")
+	defer sshServer.Close()
+	attempts, err := sshServer.login(methods)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ssh.FingerprintSHA256(agentKey), ssh.FingerprintSHA256(fileKey), "password"}, attempts)
+
+	// An IdentityFile replaces the default keys
+	identityKey := writeKey(t, tmp+"/deploy.pem", "")
+	server.IdentityFile = tmp + "/deploy.pem"
+	methods, err = servers.AuthMethods(server, tmp+"/id_rsa")
+	assert.NoError(t, err)
+
+	sshServer = serveAuth(t, identityKey, "")
+	defer sshServer.Close()
+	attempts, err = sshServer.login(methods)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ssh.FingerprintSHA256(agentKey), ssh.FingerprintSHA256(identityKey)}, attempts)
+
+	// Encrypted default keys are skipped rather than asked about while there is an agent
+	writeKey(t, tmp+"/id_ecdsa", "hunter2")
+	server = servers.Server{Name: "web", Username: "deploy"}
+	methods, err = servers.AuthMethods(server, tmp+"/id_ecdsa")
+	assert.NoError(t, err)
+
+	sshServer = serveAuth(t, nil, "")
+	defer sshServer.Close()
+	attempts, _ = sshServer.login(methods)
+	assert.Equal(t, []string{ssh.FingerprintSHA256(agentKey)}, attempts)
+}
+
+func TestEncryptedKeyPassphrase(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-auth")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	defer setInteractive(false)()
+	defer setEnv("SSH_AUTH_SOCK", nil)()
+
+	key := writeKey(t, tmp+"/deploy.pem", "hunter2")
+	server := servers.Server{Name: "web", Username: "deploy", IdentityFile: tmp + "/deploy.pem"}
+
+	// The passphrase comes from the environment
+	passphrase := "hunter2"
+	restore := setEnv(servers.KeyPassphraseEnv, &passphrase)
+	methods, err := servers.AuthMethods(server)
+	assert.NoError(t, err)
+
+	sshServer := serveAuth(t, key, "")
+	defer sshServer.Close()
+	attempts, err := sshServer.login(methods)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ssh.FingerprintSHA256(key)}, attempts)
+
+	// A wrong one fails
+	wrong := "hunter3"
+	setEnv(servers.KeyPassphraseEnv, &wrong)
+	_, err = servers.AuthMethods(server)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Unable to parse private key")
+	}
+
+	// Without one there is nobody to ask
+	setEnv(servers.KeyPassphraseEnv, nil)
+	_, err = servers.AuthMethods(server)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "stdin is not a terminal")
+	}
+	restore()
+}
@@ -0,0 +1,51 @@
+package servers
+
+import (
+	"github.com/murdinc/crusher/events"
+	"golang.org/x/crypto/ssh"
+)
+
+// Exposes the internals of the package to its tests
+var (
+	BatchJobs = batchJobs
+	JumpHosts = Servers.jumpHosts
+	Password  = RemoteOptions.password
+	NewJob    = (*RemoteJob).newJob
+)
+
+// Runs the jobs like RemoteConfigure does, with fn standing in for connecting to each server
+func RunJobs(jobs []*RemoteJob, opts RemoteOptions, fn func(*RemoteJob) error) []events.Event {
+	defer func(run func(*RemoteJob) error) { runRemoteJob = run }(runRemoteJob)
+	runRemoteJob = fn
+
+	jobEvents := make(chan events.Event, 100)
+	runJobs(jobs, opts, jobEvents)
+	close(jobEvents)
+
+	var sent []events.Event
+	for e := range jobEvents {
+		sent = append(sent, e)
+	}
+	return sent
+}
+
+// Loads the known hosts files given instead of the ones in the home folder, returning the
+// callback and algorithms for client configs
+func NewHostKeys(trustNew bool, userFile, crusherFile string) (ssh.HostKeyCallback, func(string) []string, error) {
+	defer func(user, crusher string) { userKnownHostsFile, crusherKnownHostsFile = user, crusher }(userKnownHostsFile, crusherKnownHostsFile)
+	userKnownHostsFile, crusherKnownHostsFile = userFile, crusherFile
+
+	h, err := newHostKeys(trustNew)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h.check, h.algorithms, nil
+}
+
+// Returns the auth methods for a server, with identityFiles in place of the default keys
+func AuthMethods(server Server, identityFiles ...string) ([]ssh.AuthMethod, error) {
+	defer func(files []string) { defaultIdentityFiles = files }(defaultIdentityFiles)
+	defaultIdentityFiles = identityFiles
+
+	return newKeyChain().authMethods(server)
+}
@@ -0,0 +1,157 @@
+package servers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Known hosts files that are checked, the crusher specific one is where new host keys are recorded
+var (
+	userKnownHostsFile    = "~/.ssh/known_hosts"
+	crusherKnownHostsFile = "~/.crusher_known_hosts"
+)
+
+// Verifies host keys against the known hosts files, shared by all of the jobs in a run
+type hostKeys struct {
+	sync.Mutex
+	callback ssh.HostKeyCallback
+	trustNew bool
+	record   string // The known hosts file new host keys are recorded in
+	accepted map[string]ssh.PublicKey
+}
+
+// Loads the known hosts files, if trustNew is true unknown hosts are accepted and recorded on first use
+func newHostKeys(trustNew bool) (*hostKeys, error) {
+	h := &hostKeys{
+		trustNew: trustNew,
+		record:   expandHome(crusherKnownHostsFile),
+		accepted: make(map[string]ssh.PublicKey),
+	}
+
+	var files []string
+	for _, file := range []string{expandHome(userKnownHostsFile), expandHome(crusherKnownHostsFile)} {
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+
+	if len(files) > 0 {
+		callback, err := knownhosts.New(files...)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read known hosts files: %s", err)
+		}
+		h.callback = callback
+	}
+
+	return h, nil
+}
+
+// HostKeyCallback for our ssh client configs
+func (h *hostKeys) check(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	h.Lock()
+	defer h.Unlock()
+
+	address := knownhosts.Normalize(hostname)
+
+	// Already accepted earlier in this run
+	if known, ok := h.accepted[address]; ok {
+		if string(known.Marshal()) == string(key.Marshal()) {
+			return nil
+		}
+		return fmt.Errorf("Host key mismatch for [%s]! It changed during this run, someone could be eavesdropping on you", hostname)
+	}
+
+	if h.callback != nil {
+		err := h.callback(hostname, remote, key)
+		keyErr, ok := err.(*knownhosts.KeyError)
+		if !ok {
+			return err // known host, or revoked
+		}
+
+		if len(keyErr.Want) > 0 {
+			want := keyErr.Want[0]
+			return fmt.Errorf("Host key mismatch for [%s]! Got %s %s, but %s:%d has %s %s. Someone could be eavesdropping on you, or the host key has changed",
+				hostname, key.Type(), ssh.FingerprintSHA256(key), want.Filename, want.Line, want.Key.Type(), ssh.FingerprintSHA256(want.Key))
+		}
+	}
+
+	if !h.trustNew {
+		return fmt.Errorf("Host [%s] is not in %s or %s, add it or run with --trust-new-hosts", hostname, userKnownHostsFile, crusherKnownHostsFile)
+	}
+
+	// Trust on first use
+	f, err := os.OpenFile(h.record, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Unable to record host key for [%s]: %s", hostname, err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(knownhosts.Line([]string{address}, key) + "\n"); err != nil {
+		return fmt.Errorf("Unable to record host key for [%s]: %s", hostname, err)
+	}
+
+	h.accepted[address] = key
+
+	return nil
+}
+
+// Returns the host key algorithms to ask a server for, those of the keys the known hosts files have
+// for its address, so a server with keys of several types offers the one we know. Returns nil for
+// unknown hosts, to allow any algorithm
+func (h *hostKeys) algorithms(address string) []string {
+	h.Lock()
+	defer h.Unlock()
+
+	types := make(map[string]bool)
+	if known, ok := h.accepted[knownhosts.Normalize(address)]; ok {
+		types[known.Type()] = true
+	}
+	if h.callback != nil {
+		// Every known key is wanted when the key offered matches none of them
+		err := h.callback(address, &net.TCPAddr{IP: net.IPv4zero}, noKey{})
+		if keyErr, ok := err.(*knownhosts.KeyError); ok {
+			for _, want := range keyErr.Want {
+				types[want.Key.Type()] = true
+			}
+		}
+	}
+
+	var sorted []string
+	for keyType := range types {
+		sorted = append(sorted, keyType)
+	}
+	sort.Strings(sorted)
+
+	var algorithms []string
+	for _, keyType := range sorted {
+		// RSA keys sign with SHA-2 where the server supports it
+		if keyType == ssh.KeyAlgoRSA {
+			algorithms = append(algorithms, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256)
+		}
+		algorithms = append(algorithms, keyType)
+	}
+
+	return algorithms
+}
+
+// A public key that matches no known host key
+type noKey struct{}
+
+func (noKey) Type() string {
+	return "none"
+}
+
+func (noKey) Marshal() []byte {
+	return []byte("none")
+}
+
+func (noKey) Verify(data []byte, sig *ssh.Signature) error {
+	return errors.New("Not a key")
+}
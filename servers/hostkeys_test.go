@@ -0,0 +1,153 @@
+package servers_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/murdinc/crusher/servers"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Returns a new ed25519 or rsa host key
+func newHostKey(t *testing.T, keyType string) ssh.Signer {
+	var key interface{}
+	var err error
+	if keyType == "rsa" {
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	} else {
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	assert.NoError(t, err)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+	return signer
+}
+
+// Accepts ssh handshakes with the host keys until the listener is closed
+func serveHandshakes(t *testing.T, hostKeys ...ssh.Signer) net.Listener {
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	for _, key := range hostKeys {
+		config.AddHostKey(key)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				sshConn, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for ch := range chans {
+					ch.Reject(ssh.Prohibited, "handshakes only")
+				}
+				sshConn.Close()
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func TestHostKeys(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-hostkeys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	userFile, crusherFile := tmp+"/known_hosts", tmp+"/crusher_known_hosts"
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 2222}
+
+	known, other := newHostKey(t, "ed25519"), newHostKey(t, "ed25519")
+	assert.NoError(t, ioutil.WriteFile(userFile, []byte(knownhosts.Line([]string{"10.0.0.5:2222"}, known.PublicKey())+"\n"), 0600))
+
+	// Known hosts are accepted, and asked for the algorithm of their key
+	check, algorithms, err := servers.NewHostKeys(false, userFile, crusherFile)
+	assert.NoError(t, err)
+	assert.NoError(t, check("10.0.0.5:2222", remote, known.PublicKey()))
+	assert.Equal(t, []string{ssh.KeyAlgoED25519}, algorithms("10.0.0.5:2222"))
+
+	// A different key is a mismatch
+	err = check("10.0.0.5:2222", remote, other.PublicKey())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Host key mismatch for [10.0.0.5:2222]")
+		assert.Contains(t, err.Error(), userFile+":1")
+	}
+
+	// Unknown hosts are refused, and any algorithm will do
+	err = check("10.0.0.6:22", remote, other.PublicKey())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "is not in")
+	}
+	assert.Nil(t, algorithms("10.0.0.6:22"))
+	_, err = os.Stat(crusherFile)
+	assert.True(t, os.IsNotExist(err))
+
+	// Unless they are trusted on first use, which records them
+	check, algorithms, err = servers.NewHostKeys(true, userFile, crusherFile)
+	assert.NoError(t, err)
+	assert.NoError(t, check("10.0.0.6:22", remote, other.PublicKey()))
+	assert.NoError(t, check("10.0.0.6:22", remote, other.PublicKey()))
+	assert.Equal(t, []string{ssh.KeyAlgoED25519}, algorithms("10.0.0.6:22"))
+	assert.Error(t, check("10.0.0.6:22", remote, known.PublicKey()))
+
+	recorded, err := ioutil.ReadFile(crusherFile)
+	assert.NoError(t, err)
+	assert.Equal(t, knownhosts.Line([]string{"10.0.0.6:22"}, other.PublicKey())+"\n", string(recorded))
+
+	// The next run knows them, and still refuses a different key
+	check, _, err = servers.NewHostKeys(true, userFile, crusherFile)
+	assert.NoError(t, err)
+	assert.NoError(t, check("10.0.0.6:22", remote, other.PublicKey()))
+	err = check("10.0.0.6:22", remote, known.PublicKey())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Host key mismatch for [10.0.0.6:22]")
+	}
+}
+
+func TestHostKeyAlgorithms(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-hostkeys")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// A server with an ed25519 and an rsa key, of which only the ed25519 one is known
+	edKey, rsaKey := newHostKey(t, "ed25519"), newHostKey(t, "rsa")
+	listener := serveHandshakes(t, edKey, rsaKey)
+	defer listener.Close()
+	address := listener.Addr().String()
+
+	userFile := tmp + "/known_hosts"
+	lines := knownhosts.Line([]string{address}, edKey.PublicKey()) + "\n" + knownhosts.Line([]string{"10.0.0.7:22"}, rsaKey.PublicKey()) + "\n"
+	assert.NoError(t, ioutil.WriteFile(userFile, []byte(lines), 0600))
+
+	check, algorithms, err := servers.NewHostKeys(false, userFile, tmp+"/crusher_known_hosts")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{ssh.KeyAlgoED25519}, algorithms(address))
+	assert.Equal(t, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}, algorithms("10.0.0.7:22"))
+
+	// Without asking for the known algorithm the server offers its rsa key
+	_, err = ssh.Dial("tcp", address, &ssh.ClientConfig{User: "test", HostKeyCallback: check})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Host key mismatch")
+	}
+
+	client, err := ssh.Dial("tcp", address, &ssh.ClientConfig{User: "test", HostKeyCallback: check, HostKeyAlgorithms: algorithms(address)})
+	if assert.NoError(t, err) {
+		client.Close()
+	}
+}
@@ -0,0 +1,114 @@
+package servers
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// A bastion that a RemoteJob connects through on its way to the target server
+type JumpHost struct {
+	Server  Server
+	SSHConf *ssh.ClientConfig
+}
+
+// Resolves the ProxyJump hops of a server, in the order they are connected through. Each hop is
+// either the name of another configured server, or [user@]host[:port] which can be an ssh config
+// alias, and otherwise shares the targets settings
+func (servers Servers) jumpHosts(server Server, sshConfig *SSHConfig) (Servers, error) {
+	var hops Servers
+
+	for _, hop := range strings.Split(server.ProxyJump, ",") {
+		hop = strings.TrimSpace(hop)
+		if hop == "" {
+			continue
+		}
+
+		if named, ok := servers.Find(hop); ok {
+			hops = append(hops, sshConfig.Resolve(named))
+			continue
+		}
+
+		jump := Server{Name: hop}
+		address := hop
+
+		if i := strings.LastIndex(address, "@"); i >= 0 {
+			jump.Username = address[:i]
+			address = address[i+1:]
+		}
+
+		jump.Host = address
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			jump.Host = host
+			jump.Port, err = strconv.Atoi(port)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid port in ProxyJump [%s] of server [%s]", hop, server.Name)
+			}
+		}
+
+		if jump.Host == "" {
+			return nil, fmt.Errorf("Invalid ProxyJump [%s] of server [%s]", hop, server.Name)
+		}
+
+		// Settings from the ssh config come first, then the targets
+		if jump.Username == "" {
+			jump.Username = sshConfig.get(jump.Host, "User")
+		}
+		if jump.Username == "" {
+			jump.Username = server.Username
+		}
+		if sshConfig.get(jump.Host, "IdentityFile") == "" {
+			jump.IdentityFile = server.IdentityFile
+		}
+		jump.ConnectTimeout = server.ConnectTimeout
+
+		hops = append(hops, sshConfig.Resolve(jump))
+	}
+
+	return hops, nil
+}
+
+// Finds a configured server by name
+func (servers Servers) Find(name string) (Server, bool) {
+	for _, s := range servers {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Server{}, false
+}
+
+// Opens a tcp connection to addr, directly or through the client of the previous hop, giving up once the timeout has passed
+func dialHop(via *ssh.Client, addr string, timeout time.Duration) (net.Conn, error) {
+	if via == nil {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+
+	done := make(chan dialResult, 1)
+	go func() {
+		conn, err := via.Dial("tcp", addr)
+		done <- dialResult{conn, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.conn, result.err
+	case <-time.After(timeout):
+		// Clean up after the dial if it ever finishes
+		go func() {
+			if result := <-done; result.conn != nil {
+				result.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("Connection to [%s] timed out after %s", addr, timeout)
+	}
+}
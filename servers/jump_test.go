@@ -0,0 +1,95 @@
+package servers_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/servers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJumpHosts(t *testing.T) {
+	sshConfig, err := servers.DecodeSSHConfig(strings.NewReader(`
+Host gw
+	HostName 10.0.0.9
+	User admin
+	Port 2022
+`))
+	assert.NoError(t, err)
+
+	configured := servers.Servers{
+		{Name: "bastion", Host: "10.0.0.1", Port: 2200, Username: "ops"},
+	}
+	target := servers.Server{Name: "web", Host: "10.1.0.5", Username: "deploy", IdentityFile: "~/.ssh/web.pem", ConnectTimeout: time.Second * 3}
+
+	tests := []struct {
+		proxyJump string
+		hops      []servers.Server
+	}{
+		// Configured servers are used as they are
+		{"bastion", []servers.Server{{Name: "bastion", Host: "10.0.0.1", Port: 2200, Username: "ops"}}},
+
+		// Anything else shares the settings of the target
+		{"jump@gw.example.com:2222", []servers.Server{{Name: "jump@gw.example.com:2222", Host: "gw.example.com", Port: 2222, Username: "jump", IdentityFile: "~/.ssh/web.pem", ConnectTimeout: time.Second * 3}}},
+		{"gw.example.com", []servers.Server{{Name: "gw.example.com", Host: "gw.example.com", Username: "deploy", IdentityFile: "~/.ssh/web.pem", ConnectTimeout: time.Second * 3}}},
+
+		// Unless the ssh config has them
+		{"gw", []servers.Server{{Name: "gw", Host: "10.0.0.9", Port: 2022, Username: "admin", IdentityFile: "~/.ssh/web.pem", ConnectTimeout: time.Second * 3}}},
+
+		// IPv6, with and without a port
+		{"[fe80::1]:2022", []servers.Server{{Name: "[fe80::1]:2022", Host: "fe80::1", Port: 2022, Username: "deploy", IdentityFile: "~/.ssh/web.pem", ConnectTimeout: time.Second * 3}}},
+		{"ops@::1", []servers.Server{{Name: "ops@::1", Host: "::1", Username: "ops", IdentityFile: "~/.ssh/web.pem", ConnectTimeout: time.Second * 3}}},
+	}
+
+	for _, test := range tests {
+		target.ProxyJump = test.proxyJump
+		hops, err := servers.JumpHosts(configured, target, sshConfig)
+		assert.NoError(t, err, test.proxyJump)
+		assert.Equal(t, servers.Servers(test.hops), hops, test.proxyJump)
+	}
+
+	// Chained hops are connected through in order
+	target.ProxyJump = "bastion, gw ,[::1]"
+	hops, err := servers.JumpHosts(configured, target, sshConfig)
+	assert.NoError(t, err)
+	if assert.Len(t, hops, 3) {
+		assert.Equal(t, "10.0.0.1:2200", hops[0].Address())
+		assert.Equal(t, "10.0.0.9:2022", hops[1].Address())
+		assert.Equal(t, "[::1]:22", hops[2].Address())
+	}
+
+	// Bad hops are named
+	for proxyJump, message := range map[string]string{
+		"bastion,gw:ssh": "Invalid port in ProxyJump [gw:ssh] of server [web]",
+		"ops@":           "Invalid ProxyJump [ops@] of server [web]",
+	} {
+		target.ProxyJump = proxyJump
+		_, err = servers.JumpHosts(configured, target, sshConfig)
+		if assert.Error(t, err, proxyJump) {
+			assert.Equal(t, message, err.Error())
+		}
+	}
+}
+
+func TestJumpHostFailureNamesTheHop(t *testing.T) {
+	port := closedPort(t)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	job := &servers.RemoteJob{
+		Server:         servers.Server{Name: "web", Host: "127.0.0.1", Port: port},
+		Jumps:          []servers.JumpHost{{Server: servers.Server{Name: "bastion", Host: "127.0.0.1", Port: port}}},
+		ConnectTimeout: time.Second,
+		Events:         make(chan events.Event, 100),
+		WaitGroup:      &wg,
+	}
+	job.Run()
+
+	if assert.Error(t, job.Err) {
+		assert.Contains(t, job.Err.Error(), "Unable to connect to jump host [bastion]")
+	}
+	assert.Equal(t, "Jump Host [bastion]", job.Step)
+}
@@ -0,0 +1,71 @@
+package servers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/murdinc/terminal"
+)
+
+// Environment variables that passwords and passphrases are read from before asking for them
+const (
+	PasswordEnv      = "CRUSHER_PASSWORD"
+	KeyPassphraseEnv = "CRUSHER_KEY_PASSPHRASE"
+)
+
+// Checks if stdin is a terminal that we can ask questions on, replaceable so tests can pretend
+var Interactive = func() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// Returns the error for questions we are unable to ask, because stdin is not a terminal
+func NotInteractiveError(question string) error {
+	return fmt.Errorf("Unable to ask [%s], stdin is not a terminal", question)
+}
+
+func promptBool(question string) (bool, error) {
+	if !Interactive() {
+		return false, NotInteractiveError(question)
+	}
+	return terminal.PromptBool(question), nil
+}
+
+func promptPassword(question string) (string, error) {
+	if !Interactive() {
+		return "", NotInteractiveError(question)
+	}
+	return terminal.PromptPassword(question), nil
+}
+
+// Looks up a servers password in the environment, then the password file, and finally asks for it
+func (opts RemoteOptions) password(server Server) (string, error) {
+	if password, ok := os.LookupEnv(PasswordEnv + "_" + envName(server.Name)); ok {
+		return password, nil
+	}
+	if password, ok := os.LookupEnv(PasswordEnv); ok {
+		return password, nil
+	}
+
+	if opts.PasswordFile != "" {
+		contents, err := ioutil.ReadFile(expandHome(opts.PasswordFile))
+		if err != nil {
+			return "", fmt.Errorf("Unable to read password file [%s]: %s", opts.PasswordFile, err)
+		}
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	}
+
+	return promptPassword(fmt.Sprintf("Please enter your password for user [%s] on remote server [%s]:", server.Username, server.Host))
+}
+
+// Turns a server name into the suffix of its environment variables, web-01 becomes WEB_01
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToUpper(name))
+}
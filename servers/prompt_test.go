@@ -0,0 +1,87 @@
+package servers_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/murdinc/crusher/servers"
+	"github.com/stretchr/testify/assert"
+)
+
+// Sets an environment variable, or unsets it when value is nil, returning a func that restores it
+func setEnv(key string, value *string) func() {
+	old, ok := os.LookupEnv(key)
+	if value == nil {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, *value)
+	}
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// Pretends stdin is or is not a terminal, returning a func that restores it
+func setInteractive(interactive bool) func() {
+	old := servers.Interactive
+	servers.Interactive = func() bool { return interactive }
+	return func() { servers.Interactive = old }
+}
+
+func TestPasswordLookupOrder(t *testing.T) {
+	defer setInteractive(false)()
+
+	f, err := ioutil.TempFile("", "crusher-password")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("from-file\n")
+	f.Close()
+
+	server := servers.Server{Name: "web-01", Host: "10.0.0.5", Username: "deploy", PassAuth: true}
+	opts := servers.RemoteOptions{PasswordFile: f.Name()}
+
+	perServer, shared := "per-server", "shared"
+	defer setEnv(servers.PasswordEnv+"_WEB_01", &perServer)()
+	defer setEnv(servers.PasswordEnv, &shared)()
+
+	// The servers own variable comes first
+	password, err := servers.Password(opts, server)
+	assert.NoError(t, err)
+	assert.Equal(t, "per-server", password)
+
+	// Then the shared one
+	defer setEnv(servers.PasswordEnv+"_WEB_01", nil)()
+	password, err = servers.Password(opts, server)
+	assert.NoError(t, err)
+	assert.Equal(t, "shared", password)
+
+	// Then the password file, without its trailing newline
+	defer setEnv(servers.PasswordEnv, nil)()
+	password, err = servers.Password(opts, server)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", password)
+
+	_, err = servers.Password(servers.RemoteOptions{PasswordFile: f.Name() + ".missing"}, server)
+	assert.Error(t, err)
+
+	// And there is nobody to ask without a terminal
+	_, err = servers.Password(servers.RemoteOptions{}, server)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "stdin is not a terminal")
+	}
+}
+
+func TestNoConfirmationWithoutATerminal(t *testing.T) {
+	defer setInteractive(false)()
+
+	targets := servers.Servers{{Name: "web", Host: "127.0.0.1", Spec: "hello_world"}}
+	err := targets.RemoteConfigure("web", nil, servers.RemoteOptions{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "stdin is not a terminal")
+	}
+}
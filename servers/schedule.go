@@ -0,0 +1,147 @@
+package servers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/murdinc/crusher/events"
+)
+
+// Runs the jobs in rolling batches, with at most opts.Parallel of them running at once. A batch only
+// starts once every job in the previous one succeeded, and no more jobs are started once
+// opts.MaxFailures of them have failed.
+func runJobs(jobs []*RemoteJob, opts RemoteOptions, jobEvents chan events.Event) {
+
+	batches := batchJobs(jobs, opts.BatchSize, opts.BatchPercent)
+
+	// Jobs we were unable to set up count as failures from the start
+	var mu sync.Mutex
+	failures := countFailures(jobs)
+
+	for i, batch := range batches {
+
+		if len(batches) > 1 {
+			jobEvents <- events.Event{Phase: events.Schedule, Status: events.Info, Message: fmt.Sprintf("Starting batch [%d] of [%d] with [%d] servers..", i+1, len(batches), len(batch)), Timestamp: time.Now()}
+		}
+
+		parallel := opts.Parallel
+		if parallel <= 0 || parallel > len(batch) {
+			parallel = len(batch)
+		}
+		slots := make(chan struct{}, parallel)
+
+		var wg sync.WaitGroup
+		for _, job := range batch {
+
+			if job.Err != nil {
+				continue
+			}
+
+			// Wait for a free slot, by which time any failures of the job that held it are counted
+			slots <- struct{}{}
+
+			mu.Lock()
+			tooManyFailures := opts.MaxFailures > 0 && failures >= opts.MaxFailures
+			mu.Unlock()
+
+			if tooManyFailures {
+				job.Skipped = true
+				<-slots
+				continue
+			}
+
+			job.WaitGroup = &wg
+			wg.Add(1)
+
+			// Launch it!
+			go func(job *RemoteJob) {
+				job.Run()
+
+				mu.Lock()
+				if job.Err != nil {
+					failures++
+				}
+				mu.Unlock()
+
+				<-slots
+			}(job)
+		}
+
+		wg.Wait()
+
+		if opts.MaxFailures > 0 && countFailures(jobs) >= opts.MaxFailures && (i < len(batches)-1 || batchSkipped(batch)) {
+			jobEvents <- events.Event{Phase: events.Schedule, Status: events.Failed, Message: fmt.Sprintf("Reached the limit of [%d] failed servers, not starting any more..", opts.MaxFailures), Timestamp: time.Now()}
+			skipJobs(batches[i+1:])
+			return
+		}
+
+		if !batchSucceeded(batch) && i < len(batches)-1 {
+			jobEvents <- events.Event{Phase: events.Schedule, Status: events.Failed, Message: fmt.Sprintf("Batch [%d] did not fully succeed, not starting the remaining batches..", i+1), Timestamp: time.Now()}
+			skipJobs(batches[i+1:])
+			return
+		}
+	}
+}
+
+// Splits the jobs into batches of size, or of percent of all jobs. Everything is a single batch when neither is set.
+func batchJobs(jobs []*RemoteJob, size, percent int) [][]*RemoteJob {
+
+	if size <= 0 && percent > 0 {
+		size = (len(jobs)*percent + 99) / 100
+	}
+	if size <= 0 || size > len(jobs) {
+		size = len(jobs)
+	}
+
+	var batches [][]*RemoteJob
+	for size > 0 && len(jobs) > 0 {
+		if len(jobs) < size {
+			size = len(jobs)
+		}
+		batches = append(batches, jobs[:size])
+		jobs = jobs[size:]
+	}
+
+	return batches
+}
+
+// Checks that every job in a batch ran and succeeded
+func batchSucceeded(batch []*RemoteJob) bool {
+	for _, job := range batch {
+		if job.Skipped || job.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if any job in a batch was skipped
+func batchSkipped(batch []*RemoteJob) bool {
+	for _, job := range batch {
+		if job.Skipped {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts the jobs that ran and failed
+func countFailures(jobs []*RemoteJob) int {
+	count := 0
+	for _, job := range jobs {
+		if job.Err != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Marks the jobs of the remaining batches as skipped
+func skipJobs(batches [][]*RemoteJob) {
+	for _, batch := range batches {
+		for _, job := range batch {
+			job.Skipped = true
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package servers_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/murdinc/crusher/servers"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns n jobs for the servers s1 to sn
+func newJobs(n int) []*servers.RemoteJob {
+	var jobs []*servers.RemoteJob
+	for i := 1; i <= n; i++ {
+		jobs = append(jobs, &servers.RemoteJob{Server: servers.Server{Name: fmt.Sprintf("s%d", i)}})
+	}
+	return jobs
+}
+
+func TestBatchJobs(t *testing.T) {
+	tests := []struct {
+		jobs    int
+		size    int
+		percent int
+		batches []int
+	}{
+		{10, 0, 0, []int{10}},
+		{10, 3, 0, []int{3, 3, 3, 1}},
+		{10, 20, 0, []int{10}},
+		{10, 0, 25, []int{3, 3, 3, 1}}, // 2.5 rounds up
+		{10, 0, 50, []int{5, 5}},
+		{10, 0, 100, []int{10}},
+		{3, 0, 10, []int{1, 1, 1}},  // Never less than one
+		{10, 4, 50, []int{4, 4, 2}}, // The size wins
+		{0, 2, 0, nil},
+	}
+
+	for _, test := range tests {
+		var sizes []int
+		for _, batch := range servers.BatchJobs(newJobs(test.jobs), test.size, test.percent) {
+			sizes = append(sizes, len(batch))
+		}
+		assert.Equal(t, test.batches, sizes, "%d jobs, size %d, percent %d", test.jobs, test.size, test.percent)
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	tests := []struct {
+		name    string
+		jobs    int
+		opts    servers.RemoteOptions
+		failing []string
+		ran     []string
+		skipped []string
+	}{
+		{
+			name: "everything at once",
+			jobs: 4, failing: []string{"s2"},
+			ran: []string{"s1", "s2", "s3", "s4"},
+		},
+		{
+			name: "stops after a failed batch",
+			jobs: 6, opts: servers.RemoteOptions{BatchSize: 2}, failing: []string{"s3"},
+			ran: []string{"s1", "s2", "s3", "s4"}, skipped: []string{"s5", "s6"},
+		},
+		{
+			name: "batches by percent",
+			jobs: 4, opts: servers.RemoteOptions{BatchPercent: 50}, failing: []string{"s1"},
+			ran: []string{"s1", "s2"}, skipped: []string{"s3", "s4"},
+		},
+		{
+			name: "stops at the failure limit",
+			jobs: 5, opts: servers.RemoteOptions{Parallel: 1, MaxFailures: 2}, failing: []string{"s1", "s2", "s4"},
+			ran: []string{"s1", "s2"}, skipped: []string{"s3", "s4", "s5"},
+		},
+		{
+			name: "failure limit across batches",
+			jobs: 6, opts: servers.RemoteOptions{BatchSize: 3, MaxFailures: 1}, failing: []string{"s2"},
+			ran: []string{"s1", "s2", "s3"}, skipped: []string{"s4", "s5", "s6"},
+		},
+		{
+			name: "all batches succeed",
+			jobs: 5, opts: servers.RemoteOptions{BatchSize: 2, Parallel: 1, MaxFailures: 1},
+			ran: []string{"s1", "s2", "s3", "s4", "s5"},
+		},
+	}
+
+	for _, test := range tests {
+		failing := make(map[string]bool)
+		for _, name := range test.failing {
+			failing[name] = true
+		}
+
+		var mu sync.Mutex
+		var ran []string
+		jobs := newJobs(test.jobs)
+		servers.RunJobs(jobs, test.opts, func(job *servers.RemoteJob) error {
+			mu.Lock()
+			ran = append(ran, job.Server.Name)
+			mu.Unlock()
+			if failing[job.Server.Name] {
+				return errors.New("nope")
+			}
+			return nil
+		})
+
+		var skipped []string
+		for _, job := range jobs {
+			if job.Skipped {
+				skipped = append(skipped, job.Server.Name)
+			}
+		}
+
+		assert.ElementsMatch(t, test.ran, ran, test.name)
+		assert.Equal(t, test.skipped, skipped, test.name)
+	}
+}
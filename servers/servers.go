@@ -1,46 +1,88 @@
 package servers
 
 import (
-	"bytes"
 	"fmt"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/jobs"
 	"github.com/murdinc/crusher/specr"
 	"github.com/murdinc/terminal"
 	"github.com/olekukonko/tablewriter"
-	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
 // Represents a single remote server
 type Server struct {
-	Name     string `ini:"-"` // considered Sections in config file
-	Host     string
-	Username string
-	Spec     string
-	PassAuth bool
-	Password string `ini:"-"` // Not stored in config, just where it gets temporarily stored when we ask for it.
+	Name           string `ini:"-"` // considered Sections in config file
+	Host           string
+	Port           int `ini:",omitempty"` // Defaults to 22
+	Username       string
+	Spec           string
+	PassAuth       bool
+	IdentityFile   string        `ini:",omitempty"` // Private key to use, ssh-agent and the default keys are tried when empty
+	ConnectTimeout time.Duration `ini:",omitempty"` // Time allowed to open the connection and finish the ssh handshake, defaults to 7s
+	CommandTimeout time.Duration `ini:",omitempty"` // Time allowed for each remote command, no limit when empty
+	ProxyJump      string        `ini:",omitempty"` // Comma separated jump hosts to connect through, each a server name or [user@]host[:port]
+	Class          string        `ini:",omitempty"` // Template variables for interpolated config files
+	Sequence       string        `ini:",omitempty"`
+	Locale         string        `ini:",omitempty"`
+	Password       string        `ini:"-"` // Not stored in config, just where it gets temporarily stored when we ask for it.
 }
 
+// Defaults for unset server settings
+const (
+	DefaultPort           = 22
+	DefaultConnectTimeout = time.Second * 7
+)
+
 // Slice of remote servers with attached methods
 type Servers []Server
 
+// Options for a remote configuration run
+type RemoteOptions struct {
+	TrustNewHosts bool   // Accept and record the host keys of servers we have not connected to before
+	Parallel      int    // Most servers to configure at once, no limit when 0
+	BatchSize     int    // Servers per rolling batch, all at once when 0
+	BatchPercent  int    // Servers per rolling batch as a percentage of the target group, used when BatchSize is 0
+	MaxFailures   int    // Stop starting new servers once this many have failed, no limit when 0
+	Uploads       int    // Most files to upload at once to each server, defaults to jobs.DefaultUploads
+	AssumeYes     bool   // Do not ask before configuring the servers
+	PasswordFile  string // File holding the password for servers with password auth
+	DryRun        bool   // Only report what would change
+	RunID         string // Run to roll back, or the ID of this run when empty
+	Output        string // Output format, text or json
+
+	rollback bool // Restore the files of run RunID instead of configuring
+	facts    bool // Only gather and print the facts of the servers
+}
+
 // Remote Job
 type RemoteJob struct {
-	net.Conn
-	Server    Server
-	SSHConf   *ssh.ClientConfig
-	Timeout   time.Duration
-	Responses chan string
-	Errors    chan error
-	WaitGroup *sync.WaitGroup
-	SpecList  *specr.SpecList
-	SpecName  string
-	Client    *ssh.Client
+	Server         Server
+	SSHConf        *ssh.ClientConfig
+	Jumps          []JumpHost
+	ConnectTimeout time.Duration
+	CommandTimeout time.Duration
+	Events         chan events.Event
+	WaitGroup      *sync.WaitGroup
+	SpecList       *specr.SpecList
+	SpecName       string
+	DryRun         bool
+	RunID          string
+	Uploads        int
+	Rollback       bool // Restore the files saved by run RunID instead of configuring
+	Facts          bool // Only gather the facts of the server
+	Client         *ssh.Client
+	Step           string        // The step the job is on, or failed at
+	Err            error         // Why the job failed, set once it has run
+	Skipped        bool          // Never started because of earlier failures
+	Duration       time.Duration // How long the job ran for
 }
 
 // Assembles a new Server struct
@@ -61,338 +103,431 @@ func New(name, host, username, spec string, passAuth bool) *Server {
 // Prints a single server config data in a table
 func (s *Server) PrintServerInfo() {
 
-	collumns := []string{"Name", "Host", "Username", "Spec", "Password Auth?"}
-	var rows [][]string
+	printTable(serverCollumns, [][]string{s.tableRow()})
+}
+
+// Collumns for the server info tables
+var serverCollumns = []string{"Name", "Host", "Port", "Username", "Spec", "Password Auth?", "Identity File", "Proxy Jump"}
 
-	rows = append(rows, []string{
+// Returns the server config data as a table row
+func (s *Server) tableRow() []string {
+	return []string{
 		s.Name,
 		s.Host,
+		fmt.Sprint(s.port()),
 		s.Username,
 		s.Spec,
 		fmt.Sprintf("%t", s.PassAuth),
-	})
+		s.IdentityFile,
+		s.ProxyJump,
+	}
+}
 
-	printTable(collumns, rows)
+// Returns the host:port address to connect to, handling IPv6 hosts
+func (s *Server) Address() string {
+	return net.JoinHostPort(strings.Trim(s.Host, "[]"), strconv.Itoa(s.port()))
 }
 
-// Read function with timeout
-func (r *RemoteJob) Read(b []byte) (int, error) {
-	err := r.Conn.SetReadDeadline(time.Now().Add(r.Timeout))
-	if err != nil {
-		return 0, err
+func (s *Server) port() int {
+	if s.Port == 0 {
+		return DefaultPort
 	}
-	return r.Conn.Read(b)
+	return s.Port
 }
 
-// Write function with timeout
-func (r *RemoteJob) Write(b []byte) (int, error) {
-	err := r.Conn.SetWriteDeadline(time.Now().Add(r.Timeout))
-	if err != nil {
-		return 0, err
+func (s *Server) connectTimeout() time.Duration {
+	if s.ConnectTimeout == 0 {
+		return DefaultConnectTimeout
 	}
-	return r.Conn.Write(b)
+	return s.ConnectTimeout
 }
 
-// Run Remote Configuration on a target spec group
-func (s Servers) RemoteConfigure(search string, specList *specr.SpecList) {
+// Run Remote Configuration on a target spec group, returns an error if any server failed
+func (s Servers) RemoteConfigure(search string, specList *specr.SpecList, opts RemoteOptions) error {
+
+	renderer, err := events.NewRenderer(opts.Output)
+	if err != nil {
+		return err
+	}
+
+	// Anything besides events would get in the way of machine readable output
+	quiet := events.IsJSON(renderer)
+
+	// Nothing changes on a dry run, so there is nothing to confirm
+	if opts.DryRun || opts.facts {
+		opts.AssumeYes = true
+	}
+
+	if quiet && !opts.AssumeYes {
+		err := fmt.Errorf("Unable to ask for confirmation with JSON output, use --yes to configure the servers without asking")
+		renderer.Render(events.Event{Phase: events.Setup, Status: events.Failed, Message: err.Error(), Timestamp: time.Now()})
+		return err
+	}
 
 	// Get our list of targets
 	targetGroup := s.getTargetGroup(search)
+	if len(targetGroup) == 0 {
+		err := fmt.Errorf("No servers found with the name or spec of [%s]", search)
+		if quiet {
+			renderer.Render(events.Event{Phase: events.Setup, Status: events.Failed, Message: err.Error(), Timestamp: time.Now()})
+		} else {
+			terminal.Information(fmt.Sprintf("I couldn't find any servers with the name or spec of: [%s], here is what I do have: ", search))
+			s.PrintAllServerInfo()
+		}
+		return err
+	}
 
-	configure := terminal.PromptBool("Do you want to configure these servers?")
-
-	if !configure {
-		terminal.Information("Okay, maybe next time..")
-		return
+	if !quiet {
+		terminal.Information(fmt.Sprintf("I found the following servers under [%s]:", search))
+		targetGroup.printTargetGroup()
 	}
 
-	// Get passwords for hosts that need them
-	for i, server := range targetGroup {
-		if server.PassAuth {
-			targetGroup[i].Password = terminal.PromptPassword(fmt.Sprintf("Please enter your password for user [%s] on remote server [%s]:", server.Username, server.Host))
+	if !opts.AssumeYes {
+		question := "Do you want to configure these servers?"
+		if opts.rollback {
+			question = "Do you want to roll back these servers?"
+		}
+		configure, err := promptBool(question)
+		if err != nil {
+			terminal.ErrorLine(err.Error() + ", use --yes to configure them without asking")
+			return err
+		}
+
+		if !configure {
+			terminal.Information("Okay, maybe next time..")
+			return nil
 		}
 	}
 
-	terminal.Information("Great! I'll make it so..")
+	// Every server in a run shares its ID, so they can be rolled back together
+	if !opts.rollback && !opts.facts && opts.RunID == "" {
+		opts.RunID = jobs.NewRunID()
+	}
 
-	responses := make(chan string, 10)
-	errors := make(chan error, 10)
+	// Fill in connection settings from ~/.ssh/config aliases
+	hostAliases, err := ReadSSHConfig()
+	if err != nil {
+		renderer.Render(events.Event{Phase: events.Setup, Status: events.Notice, Message: "Unable to read ssh config: " + err.Error(), Timestamp: time.Now()})
+	}
 
-	// hold onto your butts
-	var wg sync.WaitGroup
-	wg.Add(len(targetGroup))
+	knownHosts, err := newHostKeys(opts.TrustNewHosts)
+	if err != nil {
+		renderer.Render(events.Event{Phase: events.Setup, Status: events.Failed, Message: err.Error(), Timestamp: time.Now()})
+		return err
+	}
 
-	for _, server := range targetGroup {
+	keys := newKeyChain()
 
-		sshConf := &ssh.ClientConfig{
-			User: server.Username,
+	// Get passwords for hosts that need them, including jump hosts
+	passwords := make(map[string]string)
+	getPassword := func(server *Server) error {
+		if !server.PassAuth {
+			return nil
 		}
+		if _, ok := passwords[server.Name]; !ok {
+			password, err := opts.password(*server)
+			if err != nil {
+				return err
+			}
+			passwords[server.Name] = password
+		}
+		server.Password = passwords[server.Name]
+		return nil
+	}
 
-		if server.PassAuth {
-			sshConf.Auth = []ssh.AuthMethod{ssh.Password(server.Password)}
-		} else {
-			terminal.Information("SSH Key Auth is not yet implemented")
-			wg.Done()
-			continue
-			//sshConf.Auth =ssh.ClientAuth{ .. ssh stuff .. }
+	sshConfig := func(server *Server) (*ssh.ClientConfig, error) {
+		if err := getPassword(server); err != nil {
+			return nil, err
+		}
+		auth, err := keys.authMethods(*server)
+		if err != nil {
+			return nil, err
 		}
+		return &ssh.ClientConfig{
+			User:              server.Username,
+			Auth:              auth,
+			HostKeyCallback:   knownHosts.check,
+			HostKeyAlgorithms: knownHosts.algorithms(server.Address()),
+		}, nil
+	}
+
+	jobEvents := make(chan events.Event, 10)
+
+	// Set up a job for each server, any that we are unable to set up are marked as failed
+	var jobs []*RemoteJob
+
+	for _, server := range targetGroup {
 
-		timeout := time.Second * 7
-		job := RemoteJob{
-			Server:    server,
-			Responses: responses,
-			Errors:    errors,
-			Timeout:   timeout,
-			SSHConf:   sshConf,
-			WaitGroup: &wg,
-			SpecList:  specList,
-			SpecName:  server.Spec}
+		server = hostAliases.Resolve(server)
+
+		job := &RemoteJob{
+			Events:         jobEvents,
+			ConnectTimeout: server.connectTimeout(),
+			CommandTimeout: server.CommandTimeout,
+			SpecList:       specList,
+			SpecName:       server.Spec,
+			DryRun:         opts.DryRun,
+			RunID:          opts.RunID,
+			Uploads:        opts.Uploads,
+			Rollback:       opts.rollback,
+			Facts:          opts.facts}
+		jobs = append(jobs, job)
+
+		hops, err := s.jumpHosts(server, hostAliases)
+		for i := 0; err == nil && i < len(hops); i++ {
+			var hopConf *ssh.ClientConfig
+			hopConf, err = sshConfig(&hops[i])
+			job.Jumps = append(job.Jumps, JumpHost{Server: hops[i], SSHConf: hopConf})
+		}
+		if err == nil {
+			job.SSHConf, err = sshConfig(&server)
+		}
+		job.Server = server
 
-		// Launch it!
-		go job.Run()
+		if err != nil {
+			job.Step = "Setup"
+			job.Err = err
+			renderer.Render(events.Event{
+				Server:    server.Name,
+				Host:      server.Host,
+				Phase:     events.Setup,
+				Status:    events.Failed,
+				Message:   "Unable to set up this server! Skipping it..",
+				Error:     err.Error(),
+				Timestamp: time.Now(),
+			})
+		}
+	}
 
+	if !quiet {
+		terminal.Information("Great! I'll make it so..")
 	}
 
 	// Display Output of Jobs
-	go func() {
-		for {
-			select {
-			case resp := <-responses:
-				printResp(resp)
-			case err := <-errors:
-				printErr(err.Error())
-			}
+	rendered := events.Drain(jobEvents, renderer)
+
+	// hold onto your butts
+	runJobs(jobs, opts, jobEvents)
+
+	close(jobEvents)
+	<-rendered
+
+	// Summarize how each server did
+	var results []events.Event
+	failed := 0
+	for _, job := range jobs {
+		result := events.Event{
+			Server:    job.Server.Name,
+			Host:      job.Server.Host,
+			Phase:     events.Summary,
+			Status:    events.Succeeded,
+			Duration:  job.Duration,
+			Timestamp: time.Now(),
 		}
-	}()
+		if job.Skipped {
+			result.Status = events.Skipped
+			failed++
+		} else if job.Err != nil {
+			result.Status = events.Failed
+			result.Step = job.Step
+			result.Error = job.Err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	renderer.Summary(results)
 
-	wg.Wait()
+	if failed > 0 && opts.facts {
+		return fmt.Errorf("Unable to gather the facts of [%d] of [%d] servers", failed, len(jobs))
+	}
+	if failed > 0 {
+		return fmt.Errorf("[%d] of [%d] servers were not configured", failed, len(jobs))
+	}
 
-	time.Sleep(time.Second)
+	return nil
 }
 
-func printResp(msg string) {
-	template := `{{ ansi "fggreen"}}{{ . }}{{ansi ""}}
-	`
-	terminal.PrintAnsi(template, msg)
+// Restores the files replaced by a previous run on a target group, the latest run of each server if runID is empty
+func (s Servers) RemoteRollback(search, runID string, opts RemoteOptions) error {
+	opts.rollback = true
+	opts.RunID = runID
+	opts.DryRun = false
+	return s.RemoteConfigure(search, nil, opts)
 }
 
-func printErr(msg string) {
-	template := `{{ ansi "fgred"}}{{ . }}{{ansi ""}}
-	`
-	terminal.PrintAnsi(template, msg)
+// Gathers and prints the facts of a target group, without changing anything
+func (s Servers) RemoteFacts(search string, opts RemoteOptions) error {
+	opts.facts = true
+	opts.DryRun = false
+	return s.RemoteConfigure(search, nil, opts)
 }
 
-// Runs the remote Jobs and returns results on the job channels
+// Runs the remote Jobs and sends their progress on the job events channel
 func (job *RemoteJob) Run() {
+	defer job.WaitGroup.Done()
 
-	line := addSpaces("[%s] ["+job.Server.Name+" - "+job.Server.Host+"]", 45) + " >> %s " // status, name, host, message
+	start := time.Now()
+	job.Err = runRemoteJob(job)
+	job.Duration = time.Since(start)
+}
+
+// Sends an event for this job
+func (job *RemoteJob) emit(e events.Event) {
+	e.Server = job.Server.Name
+	e.Host = job.Server.Host
+	e.Timestamp = time.Now()
+	job.Events <- e
+}
+
+// Sends a failed event for this job
+func (job *RemoteJob) fail(phase, step, message string, err error) {
+	job.emit(jobs.Failure(phase, step, message, err))
+}
+
+// Connects to the server of a job and does its work, replaced in tests
+var runRemoteJob = (*RemoteJob).run
+
+func (job *RemoteJob) run() error {
 
 	// Setup
 	////////////////..........
 
-	defer job.WaitGroup.Done()
+	// Connect to any jump hosts, each through the one before it
+	var via *ssh.Client
+	for _, jump := range job.Jumps {
+		hop := "jump host [" + jump.Server.Name + "]"
+		job.Step = "Jump Host [" + jump.Server.Name + "]"
+
+		job.emit(events.Event{Phase: events.Connect, Step: jump.Server.Name, Status: events.Started, Message: "Connecting to " + hop + "..."})
+		client, err := job.connect(via, jump.Server.Address(), jump.SSHConf)
+		if err != nil {
+			job.fail(events.Connect, jump.Server.Name, "Unable to connect to "+hop+"! Aborting futher tasks for this server..", err)
+			return fmt.Errorf("Unable to connect to %s: %s", hop, err)
+		}
+		defer client.Close()
+		job.emit(events.Event{Phase: events.Connect, Step: jump.Server.Name, Status: events.Succeeded, Message: "Connected to " + hop + "!"})
+
+		via = client
+	}
 
 	// Open a tcp connection with a timeout
-	job.Responses <- fmt.Sprintf(line, "*", "Opening a new TCP connection...")
-	conn, err := net.DialTimeout("tcp", job.Server.Host+":22", job.Timeout)
+	job.Step = "Connection"
+	job.emit(events.Event{Phase: events.Connect, Status: events.Started, Message: "Opening a new TCP connection..."})
+	addr := job.Server.Address()
+	conn, err := dialHop(via, addr, job.ConnectTimeout)
 
 	if err != nil {
-		job.Errors <- fmt.Errorf(line, "X", "Unable to open TCP connection! Aborting futher tasks for this server..")
-		return
+		job.fail(events.Connect, "", "Unable to open TCP connection! Aborting futher tasks for this server..", err)
+		return fmt.Errorf("Unable to open TCP connection: %s", err)
 	}
-	job.Conn = conn // so that it gets wrapped with our timeout funcs
-	job.Responses <- fmt.Sprintf(line, "✓", "TCP connection Opened!")
+	job.emit(events.Event{Phase: events.Connect, Status: events.Succeeded, Message: "TCP connection Opened!"})
 
 	// Get an ssh client
-	job.Responses <- fmt.Sprintf(line, "*", "Creating new ssh client...")
-	c, chans, reqs, err := ssh.NewClientConn(job.Conn, job.Server.Host, job.SSHConf)
+	job.emit(events.Event{Phase: events.Connect, Status: events.Started, Message: "Creating new ssh client..."})
+	job.Client, err = newClient(conn, addr, job.SSHConf, job.ConnectTimeout)
 	if err != nil {
-		job.Errors <- fmt.Errorf(line, "X", "Unable to create SSH client! Aborting futher tasks for this server..")
-		return
+		job.fail(events.Connect, "", "Unable to create SSH client! Aborting futher tasks for this server..", err)
+		return fmt.Errorf("Unable to create SSH client: %s", err)
 	}
-	job.Client = ssh.NewClient(c, chans, reqs)
 	defer job.Client.Close()
-	job.Responses <- fmt.Sprintf(line, "✓", "SSH client creation Succeeded!")
-
-	// Elevate permissions
-	job.Responses <- fmt.Sprintf(line, "*", "Attempting to elevate permissions...")
-	err = job.runCommand("sudo uname", "sudo uname")
-	if err != nil {
-		job.Errors <- fmt.Errorf(line, "X", "Permission Elevation Failed! Aborting futher tasks for this server..")
-		return
-	}
-	job.Responses <- fmt.Sprintf(line, "✓", "Permission Elevation Succeeded!")
-
-	// Actual Work
-	////////////////..........
+	job.emit(events.Event{Phase: events.Connect, Status: events.Succeeded, Message: "SSH client creation Succeeded!"})
 
-	// Run pre configure commands
-	preCmds := job.SpecList.PreCmds(job.SpecName)
-	for _, preCmd := range preCmds {
-		job.Responses <- fmt.Sprintf(line, "*", "Running Pre-Configuration Command...")
-		err = job.runCommand(preCmd, "Pre-Configuration")
-		if err != nil {
-			job.Errors <- fmt.Errorf(line, "X", "Pre-Configuration Command Failed! Aborting futher tasks for this server..")
-			job.Errors <- fmt.Errorf("Error: %s", err)
-			return
-		}
-		job.Responses <- fmt.Sprintf(line, "✓", "Pre-Configuration Command Succeeded!")
-	}
+	executor := jobs.NewSSHExecutor(job.Client, job.CommandTimeout)
+	defer executor.Close()
 
-	// Run Apt-Get Commands
-	aptCmds := job.SpecList.AptGetCmds(job.SpecName)
-	job.Responses <- fmt.Sprintf(line, "*", "Running apt-get Command...")
-	for _, aptCmd := range aptCmds {
-		err = job.runCommand(aptCmd, "apt-get")
+	// Elevate permissions, gathering facts needs no root
+	if !job.Facts {
+		job.Step = "Permission Elevation"
+		job.emit(events.Event{Phase: events.Elevate, Step: "sudo uname", Status: events.Started, Message: "Attempting to elevate permissions..."})
+		_, err = executor.Run("sudo uname")
 		if err != nil {
-			job.Errors <- fmt.Errorf(line, "X", "Command apt-get Failed! Aborting futher tasks for this server..")
-			return
+			job.fail(events.Elevate, "sudo uname", "Permission Elevation Failed! Aborting futher tasks for this server..", err)
+			return fmt.Errorf("Permission Elevation failed: %s", err)
 		}
-		job.Responses <- fmt.Sprintf(line, "✓", "Command apt-get Succeeded!")
+		job.emit(events.Event{Phase: events.Elevate, Step: "sudo uname", Status: events.Succeeded, Message: "Permission Elevation Succeeded!"})
 	}
 
-	// Transfer any files we need to transfer
-	fileList := job.SpecList.DebianFileTransferList(job.SpecName)
-	job.Responses <- fmt.Sprintf(line, "*", "Starting remote file transfer...")
-	err = job.transferFiles(fileList, "Configuration and Content Files")
-	if err != nil {
-		job.Errors <- fmt.Errorf(line, "X", "File Transfer Failed! Aborting futher tasks for this server..")
-		return
-	}
-	job.Responses <- fmt.Sprintf(line, "✓", "File Transfer Succeeded!")
-
-	// Run post configure commands
-	postCmds := job.SpecList.PostCmds(job.SpecName)
-	for _, postCmd := range postCmds {
-		job.Responses <- fmt.Sprintf(line, "*", "Running Post-Configuration Command...")
-		err = job.runCommand(postCmd, "Post-Configuration")
-		if err != nil {
-			job.Errors <- fmt.Errorf(line, "X", "Post-Configuration Command Failed! Aborting futher tasks for this server..")
-			job.Errors <- fmt.Errorf("Error: %s", err)
-			return
+	// Actual Work
+	////////////////..........
+	configure := job.newJob(executor)
+	if job.Facts {
+		configure.Step = "Facts"
+		if err = configure.GatherFacts(); err == nil {
+			job.emit(events.Event{Phase: events.Facts, Status: events.Info, Message: "Facts:", Facts: configure.Facts})
+		} else {
+			job.fail(events.Facts, "", "Unable to gather facts!", err)
 		}
-		job.Responses <- fmt.Sprintf(line, "✓", "Post-Configuration Command Succeeded!")
+	} else if job.Rollback {
+		err = configure.Rollback(job.RunID)
+	} else {
+		err = configure.Run()
 	}
+	job.Step = configure.Step
 
 	// End of the line
+	return err
 }
 
-func (j *RemoteJob) runCommand(cmd string, name string) error {
-
-	// Open an ssh session
-	session, err := j.Client.NewSession()
-	if err != nil {
-		return err
-	}
-	defer session.Close()
-
-	var stdoutBuf, stderrBuf bytes.Buffer
-	session.Stdout = &stdoutBuf
-	session.Stderr = &stderrBuf
-
-	err = session.Run(cmd)
-
-	// TODO handle more verbose output, maybe from a verbose cli flag
-	if err != nil {
-		j.Responses <- stdoutBuf.String()
-		j.Responses <- stderrBuf.String()
+// Returns the job that configures the server through the executor, with the template
+// variables of the server
+func (job *RemoteJob) newJob(executor jobs.Executor) *jobs.Job {
+	return &jobs.Job{
+		Server:   job.Server.Name,
+		Host:     job.Server.Host,
+		Executor: executor,
+		SpecList: job.SpecList,
+		SpecName: job.SpecName,
+		DryRun:   job.DryRun,
+		RunID:    job.RunID,
+		Uploads:  job.Uploads,
+		Vars: jobs.Vars{
+			Class:    job.Server.Class,
+			Sequence: job.Server.Sequence,
+			Locale:   job.Server.Locale,
+		},
+		Events: job.Events,
 	}
-
-	return err
-
 }
 
-func (j *RemoteJob) transferFiles(fileList *specr.FileTransfers, name string) error {
-
-	line := addSpaces("[%s] ["+j.Server.Name+" - "+j.Server.Host+"]", 45) + " >> %s " // status, name, host, message
-
-	// open an sftp session.
-	sftpClient, err := sftp.NewClient(j.Client)
+// Opens an ssh client to addr, through the via client if it is not nil
+func (job *RemoteJob) connect(via *ssh.Client, addr string, conf *ssh.ClientConfig) (*ssh.Client, error) {
+	conn, err := dialHop(via, addr, job.ConnectTimeout)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer sftpClient.Close()
-
-	// Defer cleanup
-	defer j.runCommand("sudo rm -rf /tmp/crusher/*", "")
-
-	for _, file := range *fileList {
-
-		// Make our temp folder
-		j.runCommand("mkdir -p /tmp/crusher/"+file.Folder, "")
-		err = j.runCommand("sudo mkdir -p "+file.Folder, "") // should prob add chown and chmod to the config structs to set it afterwards
-		if err != nil {
-			j.Errors <- fmt.Errorf(line, "X", "Unable to make directory: "+file.Folder)
-			return err
-		}
-
-		j.Responses <- fmt.Sprintf(line, "*", "Uploading file: "+file.Destination)
-
-		// Read the local file
-		////////////////..........
-		lf, err := os.Open(file.Source)
-		defer lf.Close()
-		if err != nil {
-			j.Errors <- fmt.Errorf(line, "X", "Unable to open local file: "+file.Source)
-			return err
-		}
-
-		lfi, err := lf.Stat()
-		if err != nil {
-			j.Errors <- fmt.Errorf(line, "X", "Unable to inspect local file: "+file.Source)
-			return err
-		}
-
-		fileSize := lfi.Size()
-		fileBytes := make([]byte, fileSize)
-
-		_, err = lf.Read(fileBytes)
-		if err != nil {
-			j.Errors <- fmt.Errorf(line, "X", "Unable to read local file: "+file.Source)
-			return err
-		}
+	return newClient(conn, addr, conf, job.ConnectTimeout)
+}
 
-		// Write the remote file
-		////////////////..........
-		rf, err := sftpClient.Create("/tmp/crusher" + file.Destination)
-		defer rf.Close()
+// Runs the ssh handshake over conn, giving up once the timeout has passed
+func newClient(conn net.Conn, addr string, conf *ssh.ClientConfig, timeout time.Duration) (*ssh.Client, error) {
+	timer := time.AfterFunc(timeout, func() { conn.Close() })
 
-		if err != nil {
-			j.Errors <- fmt.Errorf(line, "X", "Unable to create file: "+file.Destination)
-			return err
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, conf)
+	if !timer.Stop() {
+		if err == nil {
+			c.Close()
 		}
-		if _, err := rf.Write(fileBytes); err != nil {
-			j.Errors <- fmt.Errorf(line, "X", "Unable to write file: "+file.Destination)
-			return err
-		}
-
-		// mv
-		j.runCommand("sudo mv /tmp/crusher"+file.Destination+" "+file.Destination, "")
-
-		j.Responses <- fmt.Sprintf(line, "✓", "Completed upload of file: "+file.Destination)
+		return nil, fmt.Errorf("SSH handshake with [%s] timed out after %s", addr, timeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
 	}
 
-	return nil
-
+	return ssh.NewClient(c, chans, reqs), nil
 }
 
 // Prints all server config data in a table
 func (servers Servers) PrintAllServerInfo() {
 
 	// Build the table elements
-	collumns := []string{"#", "Name", "Host", "Username", "Spec", "Password Auth?"}
+	collumns := append([]string{"#"}, serverCollumns...)
 
 	var rows [][]string
 
 	for i, s := range servers {
-		rows = append(rows, []string{
-			fmt.Sprint(i + 1),
-			s.Name,
-			s.Host,
-			s.Username,
-			s.Spec,
-			fmt.Sprintf("%t", s.PassAuth),
-		})
+		rows = append(rows, append([]string{fmt.Sprint(i + 1)}, s.tableRow()...))
 	}
 
 	printTable(collumns, rows)
@@ -401,36 +536,27 @@ func (servers Servers) PrintAllServerInfo() {
 // Gets the target group of servers for a specified spec
 func (servers Servers) getTargetGroup(search string) Servers {
 
-	collumns := []string{"Name", "Host", "Username", "Spec", "Password Auth?"}
-	var rows [][]string
 	var targetGroup Servers
 
 	for _, s := range servers {
 		if s.Spec == search || s.Name == search {
-
-			rows = append(rows, []string{
-				s.Name,
-				s.Host,
-				s.Username,
-				s.Spec,
-				fmt.Sprintf("%t", s.PassAuth),
-			})
-
 			targetGroup = append(targetGroup, s)
 		}
 	}
 
-	if len(rows) == 0 {
-		terminal.Information(fmt.Sprintf("I couldn't find any servers with the name or spec of: [%s], here is what I do have: ", search))
-		servers.PrintAllServerInfo()
-		os.Exit(0)
-	}
+	return targetGroup
+}
 
-	terminal.Information(fmt.Sprintf("I found the following servers under [%s]:", search))
-	printTable(collumns, rows)
+// Prints the target group in a table
+func (servers Servers) printTargetGroup() {
 
-	return targetGroup
+	var rows [][]string
 
+	for _, s := range servers {
+		rows = append(rows, s.tableRow())
+	}
+
+	printTable(serverCollumns, rows)
 }
 
 // Table helper
@@ -440,10 +566,3 @@ func printTable(header []string, rows [][]string) {
 	table.AppendBulk(rows)
 	table.Render()
 }
-
-func addSpaces(s string, w int) string {
-	if len(s) < w {
-		s += strings.Repeat(" ", w-len(s))
-	}
-	return s
-}
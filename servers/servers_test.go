@@ -1,8 +1,15 @@
 package servers_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/murdinc/crusher/events"
 	"github.com/murdinc/crusher/servers"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,3 +23,119 @@ func TestNewServer(t *testing.T) {
 
 	assert.False(t, server.PassAuth)
 }
+
+func TestServerAddress(t *testing.T) {
+	server := servers.New("testserver", "127.0.0.1", "wcrusher", "hello_world", false)
+	assert.Equal(t, "127.0.0.1:22", server.Address())
+
+	server.Port = 2222
+	assert.Equal(t, "127.0.0.1:2222", server.Address())
+
+	server.Host = "::1"
+	assert.Equal(t, "[::1]:2222", server.Address())
+
+	server.Host = "[fe80::1]"
+	assert.Equal(t, "[fe80::1]:2222", server.Address())
+}
+
+func TestSSHConfigResolve(t *testing.T) {
+	sshConfig, err := servers.DecodeSSHConfig(strings.NewReader(`
+Host web
+	HostName 10.0.0.5
+	User deploy
+	Port 2222
+	IdentityFile ~/.ssh/web.pem
+	ProxyJump bastion
+
+Host *.internal
+	User ops
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web"}, sshConfig.Aliases())
+
+	server := sshConfig.Resolve(*servers.New("web", "web", "", "hello_world", false))
+	assert.Equal(t, "10.0.0.5", server.Host)
+	assert.Equal(t, "deploy", server.Username)
+	assert.Equal(t, 2222, server.Port)
+	assert.Equal(t, "~/.ssh/web.pem", server.IdentityFile)
+	assert.Equal(t, "bastion", server.ProxyJump)
+
+	// Settings from ~/.crusher win
+	server = sshConfig.Resolve(*servers.New("web", "web", "wcrusher", "hello_world", false))
+	assert.Equal(t, "wcrusher", server.Username)
+}
+
+// Returns what fn prints to stdout
+func captureStdout(fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- string(b)
+	}()
+
+	fn()
+	w.Close()
+	return <-out
+}
+
+// Returns the address of a port that nothing listens on
+func closedPort(t *testing.T) int {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestRemoteConfigureFailures(t *testing.T) {
+	password := "secret"
+	defer setEnv(servers.PasswordEnv, &password)()
+
+	targets := servers.Servers{
+		{Name: "web", Host: "127.0.0.1", Port: closedPort(t), Username: "deploy", Spec: "hello_world", PassAuth: true, ConnectTimeout: time.Second},
+	}
+	opts := servers.RemoteOptions{AssumeYes: true, TrustNewHosts: true, Output: events.JSONOutput}
+
+	// Nothing matched
+	var err error
+	captureStdout(func() { err = targets.RemoteConfigure("db", nil, opts) })
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "No servers found with the name or spec of [db]")
+	}
+
+	// A server that failed
+	out := captureStdout(func() { err = targets.RemoteConfigure("hello_world", nil, opts) })
+	if assert.Error(t, err) {
+		assert.Equal(t, "[1] of [1] servers were not configured", err.Error())
+	}
+
+	var summary []events.Event
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var e events.Event
+		assert.NoError(t, json.Unmarshal([]byte(line), &e), line)
+		if e.Phase == events.Summary {
+			summary = append(summary, e)
+		}
+	}
+	if assert.Len(t, summary, 1) {
+		assert.Equal(t, "web", summary[0].Server)
+		assert.Equal(t, events.Failed, summary[0].Status)
+		assert.Equal(t, "Connection", summary[0].Step)
+		assert.Contains(t, summary[0].Error, "Unable to open TCP connection")
+	}
+
+	// The summary table has the step it failed at
+	opts.Output = events.TextOutput
+	out = captureStdout(func() { err = targets.RemoteConfigure("hello_world", nil, opts) })
+	assert.Error(t, err)
+	assert.Regexp(t, `FAILED STEP`, out)
+	assert.Regexp(t, `web\s*\|\s*127\.0\.0\.1\s*\|\s*failed\s*\|\s*Connection\s*\|`, out)
+}
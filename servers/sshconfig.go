@@ -0,0 +1,109 @@
+package servers
+
+import (
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/kevinburke/ssh_config"
+)
+
+// Location of the users OpenSSH client config
+var sshConfigFile = "~/.ssh/config"
+
+// The users OpenSSH client config, used to resolve Host aliases
+type SSHConfig struct {
+	config *ssh_config.Config
+}
+
+// Reads ~/.ssh/config, returning an empty SSHConfig if there is none
+func ReadSSHConfig() (*SSHConfig, error) {
+	c := new(SSHConfig)
+
+	f, err := os.Open(expandHome(sshConfigFile))
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	return DecodeSSHConfig(f)
+}
+
+// Parses an ssh config
+func DecodeSSHConfig(r io.Reader) (*SSHConfig, error) {
+	config, err := ssh_config.Decode(r)
+	return &SSHConfig{config: config}, err
+}
+
+// Returns the Host aliases that name a single host, skipping wildcard and negated patterns
+func (c *SSHConfig) Aliases() []string {
+	var aliases []string
+	if c.config == nil {
+		return aliases
+	}
+
+	for _, host := range c.config.Hosts {
+		for _, pattern := range host.Patterns {
+			alias := pattern.String()
+			if alias != "" && !strings.ContainsAny(alias, "*?!") {
+				aliases = append(aliases, alias)
+			}
+		}
+	}
+
+	return aliases
+}
+
+// Returns the server with any empty connection settings filled in from the ssh config Host entry
+// matching its Host. Settings in ~/.crusher always win over the ssh config.
+func (c *SSHConfig) Resolve(server Server) Server {
+	alias := server.Host
+
+	if hostname := c.get(alias, "HostName"); hostname != "" {
+		server.Host = strings.Replace(hostname, "%h", alias, -1)
+	}
+	if server.Username == "" {
+		server.Username = c.get(alias, "User")
+	}
+	if server.Port == 0 {
+		server.Port, _ = strconv.Atoi(c.get(alias, "Port"))
+	}
+	if server.IdentityFile == "" {
+		server.IdentityFile = c.get(alias, "IdentityFile")
+	}
+	if server.ProxyJump == "" {
+		if jump := c.get(alias, "ProxyJump"); jump != "none" {
+			server.ProxyJump = jump
+		}
+	}
+
+	// Same as ssh, fall back to the local username
+	if server.Username == "" {
+		if currentUser, err := user.Current(); err == nil {
+			server.Username = currentUser.Username
+		}
+	}
+
+	return server
+}
+
+// Looks up a key for an alias, ignoring anything we are unable to evaluate
+func (c *SSHConfig) get(alias, key string) (value string) {
+	if c.config == nil {
+		return ""
+	}
+
+	// The parser panics on Match directives, which we do not support
+	defer func() {
+		if recover() != nil {
+			value = ""
+		}
+	}()
+
+	value, _ = c.config.Get(alias, key)
+	return value
+}
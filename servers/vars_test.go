@@ -0,0 +1,76 @@
+package servers_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/murdinc/crusher/events"
+	"github.com/murdinc/crusher/jobs"
+	"github.com/murdinc/crusher/servers"
+	"github.com/murdinc/crusher/specr"
+	"github.com/stretchr/testify/assert"
+)
+
+// Keeps the files a job uploads, and succeeds at every command
+type uploadExecutor struct {
+	sync.Mutex
+	files map[string]string
+}
+
+func (u *uploadExecutor) Run(command string) (string, error) {
+	return "", nil
+}
+
+func (u *uploadExecutor) RunOutput(command string) (string, string, error) {
+	return "", "", nil
+}
+
+func (u *uploadExecutor) PutFile(src io.Reader, destination string, opts jobs.PutOptions) error {
+	b, err := ioutil.ReadAll(src)
+	u.Lock()
+	u.files[destination] = string(b)
+	u.Unlock()
+	return err
+}
+
+func (u *uploadExecutor) StatFile(path string) (os.FileInfo, error) {
+	return nil, nil
+}
+
+func (u *uploadExecutor) Close() error {
+	return nil
+}
+
+func TestServerVarsReachTemplates(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	template := []byte("${var.class}-${var.sequence}.${var.locale} ${var.specname}")
+	os.MkdirAll(root+"/web/configs/app", 0755)
+	os.MkdirAll(root+"/raw/configs/app", 0755)
+	ioutil.WriteFile(root+"/web/configs/app/app.conf", template, 0644)
+	ioutil.WriteFile(root+"/raw/configs/app/raw.conf", template, 0644)
+
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{
+		"web": {SpecRoot: root + "/web", Configs: specr.Configs{DebianRoot: "/etc/"}, Requires: []string{"raw"}},
+		"raw": {SpecRoot: root + "/raw", Configs: specr.Configs{DebianRoot: "/etc/", SkipInterpolate: true}},
+	}}
+
+	for _, server := range []servers.Server{
+		{Name: "web01", Class: "web", Sequence: "1", Locale: "sfo"},
+		{Name: "web02", Class: "api", Sequence: "2", Locale: "nyc"},
+	} {
+		executor := &uploadExecutor{files: make(map[string]string)}
+		remote := &servers.RemoteJob{Server: server, SpecList: specList, SpecName: "web", Events: make(chan events.Event, 100)}
+
+		assert.NoError(t, servers.NewJob(remote, executor).Run())
+		assert.Equal(t, server.Class+"-"+server.Sequence+"."+server.Locale+" web", executor.files["/etc/app/app.conf"], server.Name)
+
+		// Left alone with skip_interpolate
+		assert.Equal(t, string(template), executor.files["/etc/app/raw.conf"], server.Name)
+	}
+}
@@ -0,0 +1,184 @@
+package specr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The apt packages of a spec and the specs it requires, with their pins resolved
+type AptPlan struct {
+	Install              []string          // Names, or name=version when pinned
+	Pins                 map[string]string // Versions by package name
+	PinnedBy             map[string]string // Specs that pinned each package
+	Hold                 []string          // Held with apt-mark, so upgrades leave them alone
+	Remove               []string          // Removed if installed
+	Purge                []string          // Removed along with their config files if installed
+	AllowUnauthenticated bool              // Set by the specs, accepts unauthenticated packages
+}
+
+// Splits a name=version pin, version is empty for unpinned packages
+func splitPin(pkg string) (name, version string) {
+	parts := strings.SplitN(pkg, "=", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return pkg, ""
+}
+
+// Returns the apt packages of a given spec and the specs it requires. Packages pinned to different
+// versions, packages that are both installed and removed, and specs that disagree on
+// apt_allow_unauthenticated are errors
+func (s *SpecList) AptPlan(specName string) (*AptPlan, error) {
+	plan := &AptPlan{Pins: make(map[string]string), PinnedBy: make(map[string]string)}
+	var order []string
+	var errs []string
+
+	removedBy := make(map[string]string)
+	installedBy := make(map[string]string)
+	allowedBy := make(map[bool]string)
+
+	s.walkPackages(specName, make(map[string]bool), func(name string, spec *Spec) {
+		for _, field := range spec.Packages.AptGet {
+			for _, pkg := range strings.Fields(field) {
+				pkgName, version := splitPin(pkg)
+				if _, ok := installedBy[pkgName]; !ok {
+					installedBy[pkgName] = name
+					order = append(order, pkgName)
+				}
+				if version == "" {
+					continue
+				}
+				if pinned, ok := plan.Pins[pkgName]; ok && pinned != version {
+					errs = append(errs, fmt.Sprintf("[%s] is pinned to [%s] by spec [%s] and to [%s] by spec [%s]", pkgName, pinned, plan.PinnedBy[pkgName], version, name))
+					continue
+				}
+				plan.Pins[pkgName] = version
+				plan.PinnedBy[pkgName] = name
+			}
+		}
+		plan.Hold = append(plan.Hold, spec.Packages.AptHold...)
+		for _, pkg := range spec.Packages.AptRemove {
+			plan.Remove = append(plan.Remove, pkg)
+			removedBy[pkg] = name
+		}
+		for _, pkg := range spec.Packages.AptPurge {
+			plan.Purge = append(plan.Purge, pkg)
+			removedBy[pkg] = name
+		}
+		if allow := spec.Packages.AptAllowUnauthenticated; allow != nil {
+			if _, ok := allowedBy[*allow]; !ok {
+				allowedBy[*allow] = name
+			}
+		}
+	})
+
+	if len(allowedBy) > 1 {
+		errs = append(errs, fmt.Sprintf("[apt_allow_unauthenticated] is true in spec [%s] and false in spec [%s]", allowedBy[true], allowedBy[false]))
+	}
+	plan.AllowUnauthenticated = allowedBy[true] != "" && len(allowedBy) == 1
+
+	for _, pkgName := range order {
+		if version, ok := plan.Pins[pkgName]; ok {
+			plan.Install = append(plan.Install, pkgName+"="+version)
+		} else {
+			plan.Install = append(plan.Install, pkgName)
+		}
+	}
+	plan.Hold = dedupe(plan.Hold)
+	plan.Remove = dedupe(plan.Remove)
+	plan.Purge = dedupe(plan.Purge)
+
+	for _, pkg := range append(append([]string{}, plan.Remove...), plan.Purge...) {
+		if by, ok := installedBy[pkg]; ok {
+			errs = append(errs, fmt.Sprintf("[%s] is installed by spec [%s] and removed by spec [%s]", pkg, by, removedBy[pkg]))
+		}
+	}
+	for _, pkg := range plan.Hold {
+		if by, ok := removedBy[pkg]; ok {
+			errs = append(errs, fmt.Sprintf("[%s] is held, but removed by spec [%s]", pkg, by))
+		}
+	}
+
+	if len(errs) > 0 {
+		return plan, fmt.Errorf("Conflicting packages: %s", strings.Join(dedupe(errs), ", "))
+	}
+	return plan, nil
+}
+
+// Returns the pins as name=version (spec) lines, sorted by name
+func (p *AptPlan) PinList() []string {
+	var pins []string
+	for name, version := range p.Pins {
+		pins = append(pins, name+"="+version+" ("+p.PinnedBy[name]+")")
+	}
+	sort.Strings(pins)
+	return pins
+}
+
+// Returns the commands that install and hold the packages. Removals are left out, since only
+// installed packages can be removed
+func (p *AptPlan) Cmds() []string {
+	if len(p.Install) == 0 && len(p.Hold) == 0 {
+		return nil
+	}
+
+	cmds := []string{"sudo apt-get update -o Dpkg::Options::=\"--force-confdef\" -o Dpkg::Options::=\"--force-confold\""}
+
+	if len(p.Install) > 0 {
+		install := "sudo apt-get install -y -f --assume-yes"
+		if p.AllowUnauthenticated {
+			install += " --allow-unauthenticated"
+		}
+		if len(p.Pins) > 0 {
+			install += " --allow-downgrades"
+		}
+		if len(p.Hold) > 0 {
+			install += " --allow-change-held-packages"
+		}
+		cmds = append(cmds, install+" "+strings.Join(p.Install, " "))
+	}
+
+	if len(p.Hold) > 0 {
+		cmds = append(cmds, "sudo apt-mark hold "+strings.Join(p.Hold, " "))
+	}
+
+	return cmds
+}
+
+// Returns the commands that remove and purge packages, given the ones that are installed
+func (p *AptPlan) RemoveCmds(installed map[string]bool) []string {
+	var cmds []string
+	for _, list := range []struct {
+		cmd      string
+		packages []string
+	}{
+		{"sudo apt-get remove -y ", p.Remove},
+		{"sudo apt-get purge -y ", p.Purge},
+	} {
+		var present []string
+		for _, pkg := range list.packages {
+			if installed == nil || installed[pkg] {
+				present = append(present, pkg)
+			}
+		}
+		if len(present) > 0 {
+			cmds = append(cmds, list.cmd+strings.Join(present, " "))
+		}
+	}
+	return cmds
+}
+
+// Calls fn with each spec in the REQUIRES tree that does not skip its packages, once each
+func (s *SpecList) walkPackages(specName string, seen map[string]bool, fn func(name string, spec *Spec)) {
+	spec := s.Specs[specName]
+	if spec == nil || spec.Packages.SkipPackages || seen[specName] {
+		return
+	}
+	seen[specName] = true
+
+	fn(specName, spec)
+	for _, reqSpec := range spec.Requires {
+		s.walkPackages(reqSpec, seen, fn)
+	}
+}
@@ -0,0 +1,336 @@
+package specr
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// An archive that the host downloads and extracts itself, see ArchiveOnHost
+type HostArchive struct {
+	SpecName    string
+	URL         string
+	SHA256      string
+	Format      string // tar.gz or zip
+	Destination string
+	Chown       string // owner[:group] of the extracted files, left as extracted when empty
+	Record      string // Describes the archive, deployed to the host
+}
+
+// Checks that the [CONTENT] section has what its source needs
+func (c Content) validateSource() error {
+	switch c.Source {
+	case "", "spec":
+	case "git":
+		if c.GitURL == "" {
+			return fmt.Errorf("[CONTENT] has source = git, but no git_url")
+		}
+	case "archive":
+		if c.Archive == "" {
+			return fmt.Errorf("[CONTENT] has source = archive, but no archive")
+		}
+		if _, err := archiveFormat(c.Archive); err != nil {
+			return err
+		}
+		if isURL(c.Archive) && c.ArchiveSHA256 == "" {
+			return fmt.Errorf("[CONTENT] archive [%s] is downloaded, but has no archive_sha256", c.Archive)
+		}
+		if sum, err := hex.DecodeString(c.ArchiveSHA256); c.ArchiveSHA256 != "" && (err != nil || len(sum) != sha256.Size) {
+			return fmt.Errorf("[CONTENT] archive_sha256 [%s] is not a sha256 sum", c.ArchiveSHA256)
+		}
+		if c.ArchiveOnHost && !isURL(c.Archive) {
+			return fmt.Errorf("[CONTENT] archive_on_host needs an http or https archive")
+		}
+		if c.ArchiveOnHost && c.Sync {
+			return fmt.Errorf("[CONTENT] archive_on_host cannot be synced")
+		}
+	default:
+		return fmt.Errorf("[CONTENT] has unknown source [%s], expected spec, git or archive", c.Source)
+	}
+	return nil
+}
+
+// Returns the archives of a given spec and the specs it requires that are extracted on hosts of a family
+func (s *SpecList) HostArchives(specName, family string) []HostArchive {
+	return s.getHostArchives(specName, family, make(map[string]bool))
+}
+
+// Recursive unexported func for HostArchives
+func (s *SpecList) getHostArchives(specName, family string, seen map[string]bool) []HostArchive {
+	// The requested spec
+	spec := s.Specs[specName]
+	if spec == nil || seen[specName] {
+		return nil
+	}
+	seen[specName] = true
+
+	var archives []HostArchive
+	root := spec.Content.Root(family)
+	if spec.Content.Source == "archive" && spec.Content.ArchiveOnHost && root != "" {
+		format, _ := archiveFormat(spec.Content.Archive)
+		chown := Permissions{spec.Content.Owner, spec.Content.Group, "", ""}.chown()
+		archives = append(archives, HostArchive{
+			SpecName:    specName,
+			URL:         spec.Content.Archive,
+			SHA256:      strings.ToLower(spec.Content.ArchiveSHA256),
+			Format:      format,
+			Destination: root,
+			Chown:       chown,
+			Record:      archiveRecord(spec.Content.Archive, strings.ToLower(spec.Content.ArchiveSHA256)),
+		})
+	}
+
+	for _, reqSpec := range spec.Requires {
+		if reqSpec != "" {
+			archives = append(archives, s.getHostArchives(reqSpec, family, seen)...)
+		}
+	}
+
+	return archives
+}
+
+// Downloads the archive of a spec into the cache if needed, checks its sum, and extracts it
+func (spec *Spec) fetchArchive() error {
+	source := spec.Content.Archive
+	if !isURL(source) && !filepath.IsAbs(source) {
+		source = filepath.Join(spec.SpecRoot, source)
+	}
+
+	format, err := archiveFormat(source)
+	if err != nil {
+		return err
+	}
+
+	cache, err := cacheFolder("archive", source)
+	if err != nil {
+		return err
+	}
+
+	want := strings.ToLower(spec.Content.ArchiveSHA256)
+	file := source
+	if isURL(source) {
+		file = cache + "/archive." + format
+		if sum, err := fileChecksum(file); err != nil || sum != want {
+			if err := download(source, file, want); err != nil {
+				return err
+			}
+		}
+	}
+
+	sum, err := fileChecksum(file)
+	if err != nil {
+		return err
+	}
+	if want != "" && sum != want {
+		return fmt.Errorf("Archive [%s] has sha256 [%s], expected [%s]", source, sum, want)
+	}
+
+	// Extract fresh every run, so files removed from the archive are not deployed
+	folder := cache + "/files"
+	if err := os.RemoveAll(folder); err != nil {
+		return err
+	}
+	if format == "zip" {
+		err = extractZip(file, folder)
+	} else {
+		err = extractTarGz(file, folder)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to extract archive [%s]: %s", source, err)
+	}
+
+	if err := ioutil.WriteFile(cache+"/deployed", []byte(archiveRecord(spec.Content.Archive, sum)), 0644); err != nil {
+		return err
+	}
+
+	spec.contentFolder = folder + "/"
+	spec.sourceRecord = cache + "/deployed"
+	spec.ContentVersion = sum
+
+	return nil
+}
+
+// Describes a deployed archive
+func archiveRecord(archive, sum string) string {
+	return fmt.Sprintf("source = archive\narchive = %s\nsha256 = %s\n", archive, sum)
+}
+
+// Downloads a file, only keeping it if its sum matches
+func download(url, file, want string) error {
+	resp, err := http.Get(url)
+	if err != nil {
+		return fmt.Errorf("Unable to download archive [%s]: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Unable to download archive [%s]: %s", url, resp.Status)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	tmp.Close()
+	if err != nil {
+		return fmt.Errorf("Unable to download archive [%s]: %s", url, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != want {
+		return fmt.Errorf("Downloaded archive [%s] has sha256 [%s], expected [%s]", url, sum, want)
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// Returns the sha256 sum of a file
+func fileChecksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Returns tar.gz or zip, from the extension of a path or URL
+func archiveFormat(source string) (string, error) {
+	name := strings.ToLower(source)
+	if i := strings.IndexAny(name, "?#"); i >= 0 && isURL(source) {
+		name = name[:i]
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz", nil
+	case strings.HasSuffix(name, ".zip"):
+		return "zip", nil
+	}
+	return "", fmt.Errorf("Archive [%s] is not a .tar.gz, .tgz or .zip file", source)
+}
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Returns where an archive entry is extracted to, refusing entries outside of the folder
+func entryPath(folder, name string) (string, error) {
+	target := filepath.Join(folder, name)
+	if target != folder && !strings.HasPrefix(target, folder+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry [%s] is outside of the archive", name)
+	}
+	return target, nil
+}
+
+// Writes a single extracted file
+func writeEntry(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Extracts the regular files of a gzipped tarball, links and devices are skipped
+func extractTarGz(file, folder string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := entryPath(folder, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeEntry(target, tr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Extracts the files of a zip archive
+func extractZip(file, folder string) error {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, entry := range zr.File {
+		target, err := entryPath(folder, entry.Name)
+		if err != nil {
+			return err
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeEntry(target, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package specr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// Where fetched content is cached, ~/.crusher_cache when empty
+var CacheFolder = ""
+
+// Where the source of deployed content is recorded on the host, one file per spec
+const DeployedFolder = "/var/lib/crusher/deployed"
+
+// Fetches the git or archive content of a spec and the specs it requires, so their files can be
+// transferred. Content is only fetched once per run
+func (s *SpecList) FetchContent(specName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.fetchContent(specName, make(map[string]bool))
+}
+
+// Recursive unexported func for FetchContent
+func (s *SpecList) fetchContent(specName string, seen map[string]bool) error {
+	// The requested spec
+	spec := s.Specs[specName]
+	if spec == nil || seen[specName] {
+		return nil
+	}
+	seen[specName] = true
+
+	if spec.Content.Source == "git" && spec.contentFolder == "" {
+		if err := spec.fetchGit(specName); err != nil {
+			return fmt.Errorf("Unable to fetch git content of spec [%s]: %s", specName, err)
+		}
+	}
+
+	if spec.Content.Source == "archive" && !spec.Content.ArchiveOnHost && spec.contentFolder == "" {
+		if err := spec.fetchArchive(); err != nil {
+			return fmt.Errorf("Unable to fetch archive content of spec [%s]: %s", specName, err)
+		}
+	}
+
+	for _, reqSpec := range spec.Requires {
+		if err := s.fetchContent(reqSpec, seen); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the cache folder for a source, creating it if needed
+func cacheFolder(kind, source string) (string, error) {
+	root := CacheFolder
+	if root == "" {
+		currentUser, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		root = currentUser.HomeDir + "/.crusher_cache"
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	folder := filepath.Join(root, kind, hex.EncodeToString(sum[:])[:16])
+
+	return folder, os.MkdirAll(folder, 0700)
+}
@@ -0,0 +1,93 @@
+package specr
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Clones or updates the repository of a spec in the cache, checks out the requested ref, and
+// writes a record of the commit to deploy
+func (spec *Spec) fetchGit(specName string) error {
+	// Each ref gets a working tree of its own, so specs deploying different refs of a repository
+	// do not check each other's out
+	cache, err := cacheFolder("git", spec.Content.GitURL+"#"+spec.Content.GitRef)
+	if err != nil {
+		return err
+	}
+	repo := cache + "/repo"
+
+	if _, err := os.Stat(repo + "/.git"); os.IsNotExist(err) {
+		if _, err := git("", "clone", "--quiet", "--no-checkout", spec.Content.GitURL, repo); err != nil {
+			return err
+		}
+	} else if _, err := git(repo, "fetch", "--quiet", "--force", "--tags", "--prune", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		return err
+	}
+
+	commit, err := resolveRef(repo, spec.Content.GitRef)
+	if err != nil {
+		return err
+	}
+
+	if _, err := git(repo, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return err
+	}
+	if _, err := git(repo, "clean", "--quiet", "-ffdx"); err != nil {
+		return err
+	}
+
+	folder := repo
+	if subdir := strings.Trim(spec.Content.GitSubdir, "/"); subdir != "" {
+		folder = repo + "/" + subdir
+		if info, err := os.Stat(folder); err != nil || !info.IsDir() {
+			return fmt.Errorf("git_subdir [%s] is not a folder at commit [%s]", subdir, commit)
+		}
+	}
+
+	record := fmt.Sprintf("source = git\nurl = %s\nref = %s\nsubdir = %s\ncommit = %s\n", spec.Content.GitURL, spec.Content.GitRef, spec.Content.GitSubdir, commit)
+	if err := ioutil.WriteFile(cache+"/deployed-"+specName, []byte(record), 0644); err != nil {
+		return err
+	}
+
+	spec.contentFolder = folder + "/"
+	spec.sourceRecord = cache + "/deployed-" + specName
+	spec.ContentVersion = commit
+
+	return nil
+}
+
+// Returns the commit of a branch, tag or commit, or of the default branch when ref is empty
+func resolveRef(repo, ref string) (string, error) {
+	candidates := []string{"origin/HEAD", "HEAD"}
+	if ref != "" {
+		candidates = []string{"origin/" + ref, "refs/tags/" + ref, ref}
+	}
+
+	for _, candidate := range candidates {
+		if commit, err := git(repo, "rev-parse", "--quiet", "--verify", candidate+"^{commit}"); err == nil {
+			return commit, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unable to find ref [%s]", ref)
+}
+
+// Runs a git command, returning its trimmed output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,96 @@
+package specr
+
+import (
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// Prefix of the sections that define handlers, like [HANDLERS.nginx_reload]
+const handlerSectionPrefix = "HANDLERS."
+
+// A command that only runs when files under one of its paths, or one of its packages, changed
+type Handler struct {
+	Name     string   `ini:"-"`
+	Command  string   `ini:"command"`
+	Paths    []string `ini:"paths,omitempty"`
+	Packages []string `ini:"packages,omitempty"`
+}
+
+// Reads the handler sections of a spec file
+func readHandlers(cfg *ini.File) ([]Handler, error) {
+	var handlers []Handler
+
+	for _, section := range cfg.Sections() {
+		if !strings.HasPrefix(section.Name(), handlerSectionPrefix) {
+			continue
+		}
+
+		handler := Handler{Name: strings.TrimPrefix(section.Name(), handlerSectionPrefix)}
+		if err := section.MapTo(&handler); err != nil {
+			return nil, err
+		}
+		if handler.Command != "" {
+			handlers = append(handlers, handler)
+		}
+	}
+
+	return handlers, nil
+}
+
+// Checks if any of the changed files or installed packages trigger the handler
+func (h Handler) Triggered(changedFiles, installedPackages []string) bool {
+	for _, path := range h.Paths {
+		folder := strings.TrimSuffix(path, "/") + "/"
+		for _, file := range changedFiles {
+			if file == path || strings.HasPrefix(file, folder) {
+				return true
+			}
+		}
+	}
+
+	for _, pkg := range h.Packages {
+		for _, installed := range installedPackages {
+			if pkg == installed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Returns the handlers for a given spec
+func (s *SpecList) Handlers(specName string) []Handler {
+	return s.getHandlers(specName)
+}
+
+// Recursive unexported func for Handlers, each handler name is only kept once across the requires tree
+func (s *SpecList) getHandlers(specName string) []Handler {
+	// The requested spec
+	spec := s.Specs[specName]
+	if spec == nil {
+		return nil
+	}
+
+	handlers := append([]Handler{}, spec.Handlers...)
+
+	// Loop through this specs requirements to all other handlers we need
+	for _, reqSpec := range spec.Requires {
+		if reqSpec != "" {
+			handlers = append(s.getHandlers(reqSpec), handlers...) // prepend
+		}
+	}
+
+	// Dedupe, remove later ones
+	for index := 0; index < len(handlers); index++ {
+		for compare := index + 1; compare < len(handlers); compare++ {
+			if handlers[index].Name == handlers[compare].Name {
+				handlers = append(handlers[:compare], handlers[compare+1:]...)
+				compare--
+			}
+		}
+	}
+
+	return handlers
+}
@@ -0,0 +1,303 @@
+package specr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Package managers, named after their commands
+const (
+	AptGet = "apt-get"
+	Dnf    = "dnf"
+	Yum    = "yum"
+	Apk    = "apk"
+	Pacman = "pacman"
+	Zypper = "zypper"
+)
+
+// Families of distributions that share a package manager
+const (
+	Debian = "debian"
+	RedHat = "redhat"
+	Alpine = "alpine"
+	Arch   = "arch"
+	Suse   = "suse"
+)
+
+// The package managers of each family, in order of preference
+var familyManagers = map[string][]string{
+	Debian: {AptGet},
+	RedHat: {Dnf, Yum},
+	Alpine: {Apk},
+	Arch:   {Pacman},
+	Suse:   {Zypper},
+}
+
+// The families of distribution IDs found in /etc/os-release
+var distroFamilies = map[string]string{
+	"debian":              Debian,
+	"ubuntu":              Debian,
+	"linuxmint":           Debian,
+	"raspbian":            Debian,
+	"rhel":                RedHat,
+	"centos":              RedHat,
+	"fedora":              RedHat,
+	"rocky":               RedHat,
+	"almalinux":           RedHat,
+	"ol":                  RedHat,
+	"amzn":                RedHat,
+	"alpine":              Alpine,
+	"arch":                Arch,
+	"manjaro":             Arch,
+	"endeavouros":         Arch,
+	"suse":                Suse,
+	"opensuse":            Suse,
+	"opensuse-leap":       Suse,
+	"opensuse-tumbleweed": Suse,
+	"sles":                Suse,
+}
+
+// The distribution of a host, from its /etc/os-release
+type Distro struct {
+	ID        string
+	IDLike    []string
+	VersionID string
+	Name      string
+	Family    string
+	Manager   string // The package manager to install packages with
+}
+
+// Reads the contents of /etc/os-release, returning an error for distributions without a supported
+// package manager
+func ParseOSRelease(content string) (Distro, error) {
+	var distro Distro
+
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := parts[1]
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+
+		switch parts[0] {
+		case "ID":
+			distro.ID = value
+		case "ID_LIKE":
+			distro.IDLike = strings.Fields(value)
+		case "VERSION_ID":
+			distro.VersionID = value
+		case "PRETTY_NAME":
+			distro.Name = value
+		}
+	}
+
+	if distro.ID == "" {
+		return distro, fmt.Errorf("No ID in /etc/os-release")
+	}
+	if distro.Name == "" {
+		distro.Name = distro.ID
+	}
+
+	for _, id := range append([]string{distro.ID}, distro.IDLike...) {
+		if family, ok := distroFamilies[id]; ok {
+			distro.Family = family
+			break
+		}
+	}
+	if distro.Family == "" {
+		return distro, fmt.Errorf("Unsupported distribution [%s]", distro.Name)
+	}
+
+	distro.Manager = familyManagers[distro.Family][0]
+
+	// Older Red Hat releases only have yum
+	major, _ := strconv.Atoi(strings.SplitN(distro.VersionID, ".", 2)[0])
+	if distro.Family == RedHat && distro.ID != "fedora" && (distro.ID == "amzn" && major == 2 || distro.ID != "amzn" && major > 0 && major < 8) {
+		distro.Manager = Yum
+	}
+
+	return distro, nil
+}
+
+// Returns the family of a package manager
+func ManagerFamily(manager string) string {
+	for family, managers := range familyManagers {
+		for _, m := range managers {
+			if m == manager {
+				return family
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the packages a spec lists for a package manager. dnf and yum share their lists, so a
+// spec only needs one of them
+func (p Packages) forManager(manager string) []string {
+	switch manager {
+	case AptGet:
+		return p.AptGet
+	case Dnf, Yum:
+		primary, fallback := p.Dnf, p.Yum
+		if manager == Yum {
+			primary, fallback = p.Yum, p.Dnf
+		}
+		if len(primary) > 0 {
+			return primary
+		}
+		return fallback
+	case Apk:
+		return p.Apk
+	case Pacman:
+		return p.Pacman
+	case Zypper:
+		return p.Zypper
+	}
+	return nil
+}
+
+// Checks if a spec lists packages for a package manager, including apt holds and removals
+func (p Packages) hasFor(manager string) bool {
+	if manager == AptGet && len(p.AptHold)+len(p.AptRemove)+len(p.AptPurge) > 0 {
+		return true
+	}
+	return len(p.forManager(manager)) > 0
+}
+
+// Checks if a spec lists packages for any package manager
+func (p Packages) any() bool {
+	return len(p.AptGet)+len(p.AptHold)+len(p.AptRemove)+len(p.AptPurge)+len(p.Dnf)+len(p.Yum)+len(p.Apk)+len(p.Pacman)+len(p.Zypper) > 0
+}
+
+// Returns the commands that install the packages of a given spec with a package manager
+func (s *SpecList) PackageCmds(specName, manager string) []string {
+	packages := s.getPackages(specName, manager, make(map[string]bool))
+	if len(packages) == 0 && manager != AptGet {
+		return nil
+	}
+
+	list := strings.Join(packages, " ")
+	switch manager {
+	case AptGet:
+		// Conflicts are reported by AptPlan's callers
+		plan, _ := s.AptPlan(specName)
+		return plan.Cmds()
+	case Dnf:
+		return []string{"sudo dnf install -y " + list}
+	case Yum:
+		return []string{"sudo yum install -y " + list}
+	case Apk:
+		return []string{"sudo apk update", "sudo apk add " + list}
+	case Pacman:
+		return []string{"sudo pacman -Sy --noconfirm --needed " + list}
+	case Zypper:
+		return []string{"sudo zypper --non-interactive refresh", "sudo zypper --non-interactive install " + list}
+	}
+	return nil
+}
+
+// Returns the commands of every package manager other than apt-get that the spec has packages for
+func (s *SpecList) otherPackageCmds(specName string) map[string][]string {
+	cmds := make(map[string][]string)
+	for _, manager := range []string{Dnf, Yum, Apk, Pacman, Zypper} {
+		if c := s.PackageCmds(specName, manager); len(c) > 0 {
+			cmds[manager] = c
+		}
+	}
+	return cmds
+}
+
+// Returns the packages of a given spec and the specs it requires for a package manager
+func (s *SpecList) Packages(specName, manager string) (packages []string) {
+	for _, pkg := range s.getPackages(specName, manager, make(map[string]bool)) {
+		packages = append(packages, strings.Fields(pkg)...)
+	}
+	return packages
+}
+
+// Checks if a given spec or the specs it requires list any packages
+func (s *SpecList) HasPackages(specName string) bool {
+	return s.hasPackages(specName, make(map[string]bool))
+}
+
+// Returns the specs, of a given spec and the ones it requires, that list packages but none for the
+// family of a package manager
+func (s *SpecList) SpecsWithoutPackages(specName, manager string) []string {
+	return s.getSpecsWithoutPackages(specName, manager, make(map[string]bool))
+}
+
+// Recursive unexported func for Packages and PackageCmds
+func (s *SpecList) getPackages(specName, manager string, seen map[string]bool) []string {
+	// The requested spec
+	spec := s.Specs[specName]
+	if spec == nil || spec.Packages.SkipPackages || seen[specName] {
+		return nil
+	}
+	seen[specName] = true
+
+	// Gather all required packages for this spec
+	packages := append([]string{}, spec.Packages.forManager(manager)...)
+
+	// Loop through this specs requirements gather to all other packages we need
+	for _, reqSpec := range spec.Requires {
+		packages = append(packages, s.getPackages(reqSpec, manager, seen)...)
+	}
+
+	return dedupe(packages)
+}
+
+// Recursive unexported func for HasPackages
+func (s *SpecList) hasPackages(specName string, seen map[string]bool) bool {
+	spec := s.Specs[specName]
+	if spec == nil || spec.Packages.SkipPackages || seen[specName] {
+		return false
+	}
+	seen[specName] = true
+
+	if spec.Packages.any() {
+		return true
+	}
+	for _, reqSpec := range spec.Requires {
+		if s.hasPackages(reqSpec, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Recursive unexported func for SpecsWithoutPackages
+func (s *SpecList) getSpecsWithoutPackages(specName, manager string, seen map[string]bool) []string {
+	spec := s.Specs[specName]
+	if spec == nil || spec.Packages.SkipPackages || seen[specName] {
+		return nil
+	}
+	seen[specName] = true
+
+	var specs []string
+	if spec.Packages.any() && !spec.Packages.hasFor(manager) {
+		specs = append(specs, specName)
+	}
+	for _, reqSpec := range spec.Requires {
+		specs = append(specs, s.getSpecsWithoutPackages(reqSpec, manager, seen)...)
+	}
+	return specs
+}
+
+// Removes repeated entries, keeping the first of each
+func dedupe(list []string) []string {
+	seen := make(map[string]bool)
+	var deduped []string
+	for _, entry := range list {
+		if !seen[entry] {
+			seen[entry] = true
+			deduped = append(deduped, entry)
+		}
+	}
+	return deduped
+}
@@ -0,0 +1,108 @@
+package specr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Octal modes, like 644 or 0644
+var octalMode = regexp.MustCompile(`^[0-7]{3,4}$`)
+
+// Owner, group and modes for transferred files
+type Permissions struct {
+	Owner   string
+	Group   string
+	Mode    string // Octal mode of the files
+	DirMode string // Octal mode of any folders created for the files
+}
+
+// Fills in any empty settings from the defaults
+func (p Permissions) withDefaults(defaults Permissions) Permissions {
+	if p.Owner == "" {
+		p.Owner = defaults.Owner
+	}
+	if p.Group == "" {
+		p.Group = defaults.Group
+	}
+	if p.Mode == "" {
+		p.Mode = defaults.Mode
+	}
+	if p.DirMode == "" {
+		p.DirMode = defaults.DirMode
+	}
+	return p
+}
+
+// Returns the owner[:group] argument for chown, or an empty string if neither are set
+func (p Permissions) chown() string {
+	if p.Group == "" {
+		return p.Owner
+	}
+	return p.Owner + ":" + p.Group
+}
+
+// Checks that the modes are octal
+func (p Permissions) validate() error {
+	for _, mode := range []string{p.Mode, p.DirMode} {
+		if mode == "" {
+			continue
+		}
+		if !octalMode.MatchString(mode) {
+			return fmt.Errorf("Invalid mode [%s], expected an octal mode like 0644", mode)
+		}
+	}
+	return nil
+}
+
+// Parses a [PERMISSIONS] entry, in the form of [owner][:group] [mode] [dir_mode]
+func parsePermissions(value string) (Permissions, error) {
+	var p Permissions
+	var modes []string
+
+	for _, field := range strings.Fields(value) {
+		if octalMode.MatchString(field) {
+			modes = append(modes, field)
+			continue
+		}
+		if p.Owner != "" || p.Group != "" || len(modes) > 0 {
+			return p, fmt.Errorf("Invalid permissions [%s], expected [owner][:group] [mode] [dir_mode]", value)
+		}
+		parts := strings.SplitN(field, ":", 2)
+		p.Owner = parts[0]
+		if len(parts) == 2 {
+			p.Group = parts[1]
+		}
+	}
+
+	switch len(modes) {
+	case 2:
+		p.DirMode = modes[1]
+		fallthrough
+	case 1:
+		p.Mode = modes[0]
+	case 0:
+	default:
+		return p, fmt.Errorf("Invalid permissions [%s], expected [owner][:group] [mode] [dir_mode]", value)
+	}
+
+	return p, p.validate()
+}
+
+// Returns the permissions for a destination path, from the [PERMISSIONS] entry for the path itself
+// or the closest folder above it (entries ending in /), falling back to the section defaults
+func (spec *Spec) permissionsFor(destination string, defaults Permissions) Permissions {
+	match := ""
+	for path := range spec.PathPermissions {
+		if path == destination || (strings.HasSuffix(path, "/") && strings.HasPrefix(destination, path)) {
+			if len(path) > len(match) {
+				match = path
+			}
+		}
+	}
+
+	if match == "" {
+		return defaults
+	}
+	return spec.PathPermissions[match].withDefaults(defaults)
+}
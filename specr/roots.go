@@ -0,0 +1,132 @@
+package specr
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Source subfolder used for families without one of their own
+const DefaultFamily = "default"
+
+// Checks if a name is a known family, or the default one
+func knownFamily(family string) bool {
+	_, ok := familyManagers[family]
+	return ok || family == DefaultFamily
+}
+
+// Returns the destination root of a family, falling back to default_root
+func (c Configs) Root(family string) string {
+	return familyRoot(family, c.DebianRoot, c.RedHatRoot, c.AlpineRoot, c.ArchRoot, c.SuseRoot, c.DefaultRoot)
+}
+
+// Returns the destination root of a family, falling back to default_root
+func (c Content) Root(family string) string {
+	return familyRoot(family, c.DebianRoot, c.RedHatRoot, c.AlpineRoot, c.ArchRoot, c.SuseRoot, c.DefaultRoot)
+}
+
+// Sections with only a debian_root, from before specs had family roots, use it for every family
+func familyRoot(family, debian, redhat, alpine, arch, suse, fallback string) string {
+	if redhat == "" && alpine == "" && arch == "" && suse == "" && fallback == "" {
+		return debian
+	}
+
+	root := map[string]string{Debian: debian, RedHat: redhat, Alpine: alpine, Arch: arch, Suse: suse}[family]
+	if root == "" {
+		return fallback
+	}
+	return root
+}
+
+// Checks if any section of the spec has a root for a family other than Debian, or a default one
+func (spec *Spec) familyRoots() bool {
+	for _, roots := range [][]string{
+		{spec.Configs.RedHatRoot, spec.Configs.AlpineRoot, spec.Configs.ArchRoot, spec.Configs.SuseRoot, spec.Configs.DefaultRoot},
+		{spec.Content.RedHatRoot, spec.Content.AlpineRoot, spec.Content.ArchRoot, spec.Content.SuseRoot, spec.Content.DefaultRoot},
+	} {
+		for _, root := range roots {
+			if root != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the source folder for a family. When the section sets family_folders, files are split
+// into family subfolders, like configs/debian/ and configs/redhat/, and the family's own subfolder
+// or default/ is used, otherwise the folder is used as it is. Returns an empty string when the
+// family has no files
+func familyFolder(folder, family string, familyFolders bool) string {
+	if folder == "" || !familyFolders {
+		return folder
+	}
+
+	for _, name := range []string{family, DefaultFamily} {
+		if isDir(filepath.Join(folder, name)) {
+			return filepath.Join(folder, name) + "/"
+		}
+	}
+	return ""
+}
+
+// Returns the folder of config files of a spec for a family
+func (spec *Spec) configsFolder(family string) string {
+	return familyFolder(spec.SpecRoot+"/configs/", family, spec.Configs.FamilyFolders)
+}
+
+// Returns the folder of content files of a spec for a family. Fetched content is only there once
+// FetchContent has run
+func (spec *Spec) contentSourceFolder(family string) string {
+	folder := spec.SpecRoot + "/content/"
+	if spec.Content.Source != "spec" {
+		folder = spec.contentFolder
+	}
+	return familyFolder(folder, family, spec.Content.FamilyFolders)
+}
+
+// Checks if a path is a folder
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// Returns the known families
+func Families() []string {
+	return []string{Debian, RedHat, Alpine, Arch, Suse}
+}
+
+// Checks that a family name is known, for flags that pick one
+func ValidateFamily(family string) error {
+	if family != "" && !knownFamily(family) || family == DefaultFamily {
+		return fmt.Errorf("Unknown family [%s], expected one of %v", family, Families())
+	}
+	return nil
+}
+
+// Checks if the files of a given spec or the specs it requires depend on the family of the host
+func (s *SpecList) FamilySpecific(specName string) bool {
+	return s.familySpecific(specName, make(map[string]bool))
+}
+
+// Recursive unexported func for FamilySpecific
+func (s *SpecList) familySpecific(specName string, seen map[string]bool) bool {
+	spec := s.Specs[specName]
+	if spec == nil || seen[specName] {
+		return false
+	}
+	seen[specName] = true
+
+	if spec.familyRoots() {
+		return true
+	}
+	if spec.Configs.FamilyFolders || spec.Content.FamilyFolders {
+		return true
+	}
+	for _, reqSpec := range spec.Requires {
+		if s.familySpecific(reqSpec, seen) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,20 +1,15 @@
 package specr
 
 import (
-	"bytes"
-	"errors"
+	"fmt"
 	"os"
-	"os/exec"
 	"os/user"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
-	"time"
 
 	gotree "github.com/DiSiqueira/GoTree"
-	"github.com/hashicorp/hil"
-	"github.com/hashicorp/hil/ast"
 	"github.com/murdinc/terminal"
 	"github.com/olekukonko/tablewriter"
 
@@ -25,6 +20,7 @@ import (
 ////////////////..........
 type SpecList struct {
 	Specs map[string]*Spec
+	mu    sync.Mutex // Held while fetching content
 	// using a map for fast lookups, but maybe we want to use a slice if we start caring about the order they output
 }
 
@@ -37,21 +33,67 @@ type Spec struct {
 	Commands Commands `ini:"COMMANDS"`
 	SpecFile string   `ini:"-"`
 	SpecRoot string   `ini:"-"`
+
+	PathPermissions map[string]Permissions `ini:"-"` // From the [PERMISSIONS] section, keyed by destination path
+	Handlers        []Handler              `ini:"-"` // From the [HANDLERS.<name>] sections
+	ContentVersion  string                 `ini:"-"` // Commit of fetched git content, or sha256 of a fetched archive
+
+	contentFolder string // Fetched content, see FetchContent
+	sourceRecord  string // Describes the fetched content, deployed to the host
 }
 
 type Packages struct {
-	AptGet       []string `ini:"apt_get"`
-	SkipPackages bool     `ini:"skip_packages"`
+	AptGet                  []string `ini:"apt_get"`                             // Names, or name=version to pin a version
+	AptHold                 []string `ini:"apt_hold,omitempty"`                  // Held with apt-mark after installing
+	AptRemove               []string `ini:"apt_remove,omitempty"`                // Removed if installed
+	AptPurge                []string `ini:"apt_purge,omitempty"`                 // Removed with their config files if installed
+	AptAllowUnauthenticated *bool    `ini:"apt_allow_unauthenticated,omitempty"` // Install with --allow-unauthenticated, nil when not set
+	Dnf                     []string `ini:"dnf,omitempty"`
+	Yum                     []string `ini:"yum,omitempty"`
+	Apk                     []string `ini:"apk,omitempty"`
+	Pacman                  []string `ini:"pacman,omitempty"`
+	Zypper                  []string `ini:"zypper,omitempty"`
+	SkipPackages            bool     `ini:"skip_packages"`
 }
 
 type Configs struct {
-	DebianRoot      string `ini:"debian_root"`
-	SkipInterpolate bool   `ini:"skip_interpolate"`
+	DebianRoot      string   `ini:"debian_root"`
+	RedHatRoot      string   `ini:"redhat_root,omitempty"`
+	AlpineRoot      string   `ini:"alpine_root,omitempty"`
+	ArchRoot        string   `ini:"arch_root,omitempty"`
+	SuseRoot        string   `ini:"suse_root,omitempty"`
+	DefaultRoot     string   `ini:"default_root,omitempty"` // For families without a root of their own
+	FamilyFolders   bool     `ini:"family_folders"`         // Files are split into family subfolders, like configs/debian/
+	SkipInterpolate bool     `ini:"skip_interpolate"`
+	Owner           string   `ini:"owner,omitempty"`
+	Group           string   `ini:"group,omitempty"`
+	Mode            string   `ini:"mode,omitempty"`
+	DirMode         string   `ini:"dir_mode,omitempty"`
+	Sync            bool     `ini:"sync"`              // Delete files under debian_root that are not in the spec
+	Exclude         []string `ini:"exclude,omitempty"` // Files to leave alone when syncing
 }
 
 type Content struct {
-	Source     string `ini:"source"`
-	DebianRoot string `ini:"debian_root"`
+	Source        string   `ini:"source"` // spec, git or archive
+	DebianRoot    string   `ini:"debian_root"`
+	RedHatRoot    string   `ini:"redhat_root,omitempty"`
+	AlpineRoot    string   `ini:"alpine_root,omitempty"`
+	ArchRoot      string   `ini:"arch_root,omitempty"`
+	SuseRoot      string   `ini:"suse_root,omitempty"`
+	DefaultRoot   string   `ini:"default_root,omitempty"` // For families without a root of their own
+	FamilyFolders bool     `ini:"family_folders"`         // Files are split into family subfolders, like content/debian/
+	GitURL        string   `ini:"git_url,omitempty"`
+	GitRef        string   `ini:"git_ref,omitempty"`        // Branch, tag or commit, defaults to the default branch
+	GitSubdir     string   `ini:"git_subdir,omitempty"`     // Folder in the repository to deploy, defaults to all of it
+	Archive       string   `ini:"archive,omitempty"`        // Path or http(s) URL of a .tar.gz, .tgz or .zip file
+	ArchiveSHA256 string   `ini:"archive_sha256,omitempty"` // Required for URLs
+	ArchiveOnHost bool     `ini:"archive_on_host"`          // Download and extract the archive on the host itself
+	Owner         string   `ini:"owner,omitempty"`
+	Group         string   `ini:"group,omitempty"`
+	Mode          string   `ini:"mode,omitempty"`
+	DirMode       string   `ini:"dir_mode,omitempty"`
+	Sync          bool     `ini:"sync"`              // Delete files under debian_root that are not in the spec
+	Exclude       []string `ini:"exclude,omitempty"` // Files to leave alone when syncing
 }
 
 type Commands struct {
@@ -68,8 +110,15 @@ type SpecSummary struct {
 	Requires  []string
 	PreCmds   []string
 	AptCmds   []string
+	AptPins   []string            // name=version (spec) of each pinned apt package
+	AptRemove []string            // Removed if installed, the remove or purge command only runs for those
+	Conflicts string              // Why the apt packages of the specs conflict
+	PkgCmds   map[string][]string // Commands of the other package managers the spec has packages for
+	Family    string
 	Transfers *FileTransfers
 	PostCmds  []string
+	Handlers  []Handler
+	SyncRoots []SyncRoot
 }
 
 // FileTransfer Struct
@@ -78,26 +127,12 @@ type FileTransfer struct {
 	Source      string
 	Destination string
 	Folder      string
-	Chown       string
+	Chown       string // owner[:group] of the file and any folders created for it
 	Chmod       string
+	DirChmod    string // Mode of any folders created for the file
 	Interpolate bool
 }
 
-// Jobs that run locally
-type LocalJob struct {
-	Class       string
-	Sequence    string
-	Locale      string
-	Deltas      chan string
-	Notices     chan string
-	Responses   chan string
-	Information chan string
-	Errors      chan error
-	SpecName    string
-	SpecList    *SpecList
-	WaitGroup   *sync.WaitGroup
-}
-
 type FileTransfers []FileTransfer
 
 // Reads in all the specs and builds a SpecList
@@ -150,6 +185,35 @@ func (s *SpecList) scanFile(file string) error {
 		}
 		spec.SpecFile = file
 		spec.SpecRoot = path.Dir(file)
+
+		defaults := []Permissions{
+			{spec.Configs.Owner, spec.Configs.Group, spec.Configs.Mode, spec.Configs.DirMode},
+			{spec.Content.Owner, spec.Content.Group, spec.Content.Mode, spec.Content.DirMode},
+		}
+		for _, p := range defaults {
+			if err := p.validate(); err != nil {
+				return fmt.Errorf("%s: %s", file, err)
+			}
+		}
+
+		if err := spec.Content.validateSource(); err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+
+		spec.PathPermissions = make(map[string]Permissions)
+		for destination, value := range cfg.Section("PERMISSIONS").KeysHash() {
+			p, err := parsePermissions(value)
+			if err != nil {
+				return fmt.Errorf("%s: %s", file, err)
+			}
+			spec.PathPermissions[destination] = p
+		}
+
+		spec.Handlers, err = readHandlers(cfg)
+		if err != nil {
+			return fmt.Errorf("%s: %s", file, err)
+		}
+
 		s.Specs[specName] = spec
 	}
 
@@ -165,13 +229,13 @@ func (s *SpecList) SpecExists(spec string) bool {
 }
 
 // Returns the apt-get commands for a given spec
-func (s *SpecList) AptGetCmds(specName string) (cmds []string) {
-	packages := s.getAptPackages(specName)
-	if len(packages) > 0 {
-		cmds = []string{"sudo apt-get update -o Dpkg::Options::=\"--force-confdef\" -o Dpkg::Options::=\"--force-confold\"", "sudo apt-get install -y -f --assume-yes --allow-unauthenticated " + strings.Join(packages, " ")}
-	}
+func (s *SpecList) AptGetCmds(specName string) []string {
+	return s.PackageCmds(specName, AptGet)
+}
 
-	return cmds
+// Returns the apt packages for a given spec, including the ones it requires
+func (s *SpecList) AptPackages(specName string) []string {
+	return s.Packages(specName, AptGet)
 }
 
 // Returns the pre-configure commands
@@ -192,16 +256,16 @@ func (s *SpecList) PostCmds(specName string) []string {
 }
 
 func (s *SpecList) DebianFileTransferList(specName string) *FileTransfers {
+	return s.FileTransferList(specName, Debian)
+}
 
-	fileTransfers := new(FileTransfers)
-
-	fileTransfers = s.getDebianFileTransfers(specName)
-	return fileTransfers
-
+// Returns the files a given spec and the specs it requires transfer to hosts of a family
+func (s *SpecList) FileTransferList(specName, family string) *FileTransfers {
+	return s.getFileTransfers(specName, family).dedupe()
 }
 
 // Recursive unexported func for FileTransferList
-func (s *SpecList) getDebianFileTransfers(specName string) *FileTransfers {
+func (s *SpecList) getFileTransfers(specName, family string) *FileTransfers {
 
 	// The requested spec
 	spec := s.Specs[specName]
@@ -213,22 +277,27 @@ func (s *SpecList) getDebianFileTransfers(specName string) *FileTransfers {
 
 	// Spec Configs
 	////////////////..........
-	srcConfFolder := spec.SpecRoot + "/configs/"
-	destConfFolder := spec.Configs.DebianRoot
+	srcConfFolder := spec.configsFolder(family)
+	destConfFolder := spec.Configs.Root(family)
 	interpolate := true
 	if spec.Configs.SkipInterpolate == true {
 		interpolate = false
 	}
+	confPermissions := Permissions{spec.Configs.Owner, spec.Configs.Group, spec.Configs.Mode, spec.Configs.DirMode}
 
-	if spec.Configs.DebianRoot != "" {
+	if destConfFolder != "" && srcConfFolder != "" {
 		// Walk the Configs folder and append each file
 		walkFn := func(path string, fileInfo os.FileInfo, inErr error) (err error) {
 			if inErr == nil && !fileInfo.IsDir() {
 				destination := destConfFolder + strings.TrimPrefix(path, srcConfFolder)
+				permissions := spec.permissionsFor(destination, confPermissions)
 				files.add(FileTransfer{
 					Source:      path,
 					Destination: destination,
 					Folder:      filepath.Dir(destination),
+					Chown:       permissions.chown(),
+					Chmod:       permissions.Mode,
+					DirChmod:    permissions.DirMode,
 					Interpolate: interpolate,
 				})
 			}
@@ -239,18 +308,26 @@ func (s *SpecList) getDebianFileTransfers(specName string) *FileTransfers {
 
 	// Spec Content
 	////////////////..........
-	srcContentFolder := spec.SpecRoot + "/content/"
-	destContentFolder := spec.Content.DebianRoot
+	srcContentFolder := spec.contentSourceFolder(family)
+	destContentFolder := spec.Content.Root(family)
+	contentPermissions := Permissions{spec.Content.Owner, spec.Content.Group, spec.Content.Mode, spec.Content.DirMode}
 
-	if spec.Content.DebianRoot != "" && spec.Content.Source == "spec" {
-		// Walk the Configs folder and append each file
+	if destContentFolder != "" && srcContentFolder != "" {
+		// Walk the Content folder and append each file
 		walkFn := func(path string, fileInfo os.FileInfo, inErr error) (err error) {
+			if inErr == nil && fileInfo.IsDir() && fileInfo.Name() == ".git" {
+				return filepath.SkipDir
+			}
 			if inErr == nil && !fileInfo.IsDir() {
 				destination := destContentFolder + strings.TrimPrefix(path, srcContentFolder)
+				permissions := spec.permissionsFor(destination, contentPermissions)
 				files.add(FileTransfer{
 					Source:      path,
 					Destination: destination,
 					Folder:      filepath.Dir(destination),
+					Chown:       permissions.chown(),
+					Chmod:       permissions.Mode,
+					DirChmod:    permissions.DirMode,
 				})
 			}
 			return
@@ -258,10 +335,20 @@ func (s *SpecList) getDebianFileTransfers(specName string) *FileTransfers {
 		filepath.Walk(srcContentFolder, walkFn)
 	}
 
+	// Record where fetched content came from
+	if spec.sourceRecord != "" {
+		destination := DeployedFolder + "/" + specName
+		files.add(FileTransfer{
+			Source:      spec.sourceRecord,
+			Destination: destination,
+			Folder:      DeployedFolder,
+		})
+	}
+
 	// Requirement Spec File List
 	////////////////..........
 	for _, reqSpec := range spec.Requires {
-		reqFiles := s.getDebianFileTransfers(reqSpec)
+		reqFiles := s.getFileTransfers(reqSpec, family)
 		*files = append(*files, *reqFiles...)
 	}
 
@@ -272,286 +359,95 @@ func (f *FileTransfers) add(file FileTransfer) {
 	*f = append(*f, file)
 }
 
-func (s *SpecList) ShowSpecBuild(specName string) {
+// Keeps one transfer per destination, the last one listed, so specs required more than once in a
+// REQUIRES tree are only uploaded once
+func (f *FileTransfers) dedupe() *FileTransfers {
+	last := make(map[string]int)
+	for i, file := range *f {
+		last[file.Destination] = i
+	}
+
+	files := new(FileTransfers)
+	for i, file := range *f {
+		if last[file.Destination] == i {
+			files.add(file)
+		}
+	}
+	return files
+}
+
+// Shows what a given spec builds on hosts of a family, Debian when family is empty
+func (s *SpecList) ShowSpecBuild(specName, family string) {
+	if family == "" {
+		family = Debian
+	}
+
+	// Without fetched content only the spec's own files are listed
+	if err := s.FetchContent(specName); err != nil {
+		terminal.ErrorLine(err.Error())
+	}
+
+	aptPlan, err := s.AptPlan(specName)
+	conflicts := ""
+	if err != nil {
+		conflicts = err.Error()
+	}
 
 	terminal.PrintAnsi(SpecBuildTemplate, SpecSummary{
 		Name:      specName,
 		Requires:  s.Requires(specName),
 		PreCmds:   s.PreCmds(specName),
 		AptCmds:   s.AptGetCmds(specName),
-		Transfers: s.DebianFileTransferList(specName),
+		AptPins:   aptPlan.PinList(),
+		AptRemove: aptPlan.RemoveCmds(nil),
+		Conflicts: conflicts,
+		PkgCmds:   s.otherPackageCmds(specName),
+		Family:    family,
+		Transfers: s.FileTransferList(specName, family),
 		PostCmds:  s.PostCmds(specName),
+		Handlers:  s.Handlers(specName),
+		SyncRoots: s.SyncRoots(specName, family),
 	})
 }
 
 var SpecBuildTemplate = `
 {{ansi ""}}{{ ansi "underscore"}}{{ ansi "bright" }}{{ ansi "fgwhite"}}[{{ .Name }}]{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}                  Family: {{ ansi ""}}{{ ansi "fgcyan"}}{{ .Family }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}                Requires: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range .Requires }}{{ . }}
 				  {{ end }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}  pre-configure Commands: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range .PreCmds }}{{ . }}
 				  {{ end }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}        apt-get Commands: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range .AptCmds }}{{ . }}
 				  {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}} apt-get Remove If Found: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range .AptRemove }}{{ . }}
+				  {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}     Pinned apt Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range .AptPins }}{{ . }}
+				  {{ end }}{{ ansi ""}}{{ if .Conflicts }}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}       Package Conflicts: {{ ansi ""}}{{ ansi "fgred"}}{{ .Conflicts }}{{ ansi ""}}
+{{ end }}	{{ ansi "bright"}}{{ ansi "fgwhite"}}  Other Package Commands: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $manager, $cmds := .PkgCmds }}{{ range $cmds }}[{{ $manager }}] {{ . }}
+				  {{ end }}{{ end }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}          File Transfers: {{ ansi ""}}{{ ansi "fgcyan"}}{{range .Transfers}}
 				      Source: {{ .Source }}
 				 Destination: {{ .Destination }}
-				      Folder: {{ .Folder }}
+				      Folder: {{ .Folder }}{{ if .Chown }}
+				       Owner: {{ .Chown }}{{ end }}{{ if .Chmod }}
+				        Mode: {{ .Chmod }}{{ end }}{{ if .DirChmod }}
+				 Folder Mode: {{ .DirChmod }}{{ end }}
+				 {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}          Synced Folders: {{ ansi ""}}{{ ansi "fgcyan"}}{{range .SyncRoots}}
+				 Destination: {{ .Destination }}
+				     Exclude: {{ range .Exclude }}{{ . }} {{ end }}
 				 {{ end }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}} post-configure Commands: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range .PostCmds }}{{ . }}
 				  {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}                Handlers: {{ ansi ""}}{{ ansi "fgcyan"}}{{range .Handlers}}
+				        Name: {{ .Name }}
+				     Command: {{ .Command }}
+				       Paths: {{ range .Paths }}{{ . }} {{ end }}
+				    Packages: {{ range .Packages }}{{ . }} {{ end }}
+				 {{ end }}{{ ansi ""}}
 `
 
-// Run Local configuration on this machine
-func (s *SpecList) LocalConfigure(specName, class, sequence, locale string) {
-	// Doesn't really need to use a goroutine now, but maybe we want to run tasks concurrently in the future?
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-
-	deltas := make(chan string, 10)
-	notices := make(chan string, 10)
-	responses := make(chan string, 10)
-	information := make(chan string, 10)
-	errors := make(chan error, 10)
-
-	job := LocalJob{
-		Deltas:      deltas,
-		Notices:     notices,
-		Responses:   responses,
-		Information: information,
-		Errors:      errors,
-		SpecName:    specName,
-		SpecList:    s,
-		WaitGroup:   &wg,
-		Class:       class,
-		Sequence:    sequence,
-		Locale:      locale,
-	}
-
-	// Launch it!
-	go job.Run()
-
-	// Display Output of Job
-	go func() {
-		for {
-			select {
-			case delta := <-deltas:
-				terminal.Delta(delta)
-			case notice := <-notices:
-				terminal.Notice(notice)
-			case resp := <-responses:
-				terminal.Response(resp)
-			case info := <-information:
-				terminal.Information(info)
-			case err := <-errors:
-				terminal.ErrorLine(err.Error())
-			}
-		}
-	}()
-
-	wg.Wait()
-
-	time.Sleep(time.Second)
-}
-
-func (job *LocalJob) Run() {
-	defer job.WaitGroup.Done()
-
-	// Run pre configure commands
-	preCmds := job.SpecList.PreCmds(job.SpecName)
-	for _, preCmd := range preCmds {
-		job.Deltas <- "Running pre-configuration command: [" + preCmd + "]"
-		_, err := job.runCommand(preCmd, "pre-configuration")
-		if err != nil {
-			job.Errors <- err
-			job.Errors <- errors.New("pre-configuration command: [" + preCmd + "] Failed! Aborting futher tasks for this server..")
-			return
-		}
-		job.Information <- "pre-configuration command: [" + preCmd + "] Succeeded!"
-	}
-
-	// Run Apt-Get Commands
-	aptCmds := job.SpecList.AptGetCmds(job.SpecName)
-	for _, aptCmd := range aptCmds {
-		job.Deltas <- "Running apt-get command: [" + aptCmd + "]"
-		_, err := job.runCommand(aptCmd, "apt-get")
-		if err != nil {
-			job.Errors <- err
-			job.Errors <- errors.New("apt-get command: [" + aptCmd + "] Failed! Aborting futher tasks for this server..")
-			return
-		}
-		job.Information <- "apt-get command: [" + aptCmd + "] Succeeded!"
-	}
-
-	// Transfer any files we need to transfer
-	fileList := job.SpecList.DebianFileTransferList(job.SpecName)
-	if len(*fileList) > 0 {
-		job.Deltas <- "Starting file copy..."
-		err := job.transferFiles(fileList, "Configuration and Content Files")
-		if err != nil {
-			job.Errors <- errors.New("File Copy Failed! Aborting futher tasks for this server..")
-			return
-		}
-		job.Information <- "File Copy Succeeded!"
-	}
-
-	// Run post configure commands
-	postCmds := job.SpecList.PostCmds(job.SpecName)
-	for _, postCmd := range postCmds {
-		job.Deltas <- "Running post-configuration command: [" + postCmd + "]"
-		_, err := job.runCommand(postCmd, "post-configuration")
-		if err != nil {
-			job.Errors <- err
-			job.Errors <- errors.New("post-configuration command: [" + postCmd + "] Failed!")
-		} else {
-			job.Information <- "post-configuration command: [" + postCmd + "] Succeeded!"
-		}
-	}
-
-	// End of the line
-}
-
-func (j *LocalJob) runCommand(command string, name string) (string, error) {
-
-	if len(command) > 0 {
-		parts := strings.Fields(command)
-		cmd := exec.Command(parts[0], parts[1:]...)
-
-		var stdoutBuf, stderrBuf bytes.Buffer
-		cmd.Stdout = &stdoutBuf
-		cmd.Stderr = &stderrBuf
-
-		err := cmd.Run()
-
-		// TODO handle more verbose output, maybe from a verbose cli flag
-		if err != nil {
-			j.Responses <- stdoutBuf.String()
-			j.Responses <- stderrBuf.String()
-		}
-
-		return stdoutBuf.String(), err
-	}
-
-	return "empty command!", nil
-
-}
-
-func (j *LocalJob) transferFiles(fileList *FileTransfers, name string) error {
-
-	// Defer cleanup
-	defer j.runCommand("sudo rm -rf /tmp/crusher/*", "")
-
-	for _, file := range *fileList {
-
-		// Make our temp folder
-		j.runCommand("mkdir -p /tmp/crusher/"+file.Folder, "")
-		_, err := j.runCommand("sudo mkdir -p "+file.Folder, "") // should prob add chown and chmod to the config structs to set it afterwards
-		if err != nil {
-			j.Errors <- errors.New("Unable to make directory: " + file.Folder)
-			return err
-		}
-
-		j.Responses <- "Copying file: " + file.Destination
-
-		// Read the file
-		////////////////..........
-		rf, err := os.Open(file.Source)
-		defer rf.Close()
-		if err != nil {
-			j.Errors <- errors.New("Unable to open file: " + file.Source)
-			return err
-		}
-
-		rfi, err := rf.Stat()
-		if err != nil {
-			j.Errors <- errors.New("Unable to inspect file: " + file.Source)
-			return err
-		}
-
-		fileSize := rfi.Size()
-		fileBytes := make([]byte, fileSize)
-
-		_, err = rf.Read(fileBytes)
-		if err != nil {
-			j.Errors <- errors.New("Unable to read file: " + file.Source)
-			return err
-		}
-
-		var outputFile []byte
-
-		if file.Interpolate {
-
-			j.Deltas <- "Interpolating on file: " + file.Destination
-
-			// Interpolate
-			////////////////..........
-			tree, err := hil.Parse(string(fileBytes))
-			if err != nil {
-				j.Errors <- errors.New("Unable to parse file: " + file.Source)
-				return err
-			}
-
-			config := &hil.EvalConfig{
-				GlobalScope: &ast.BasicScope{
-					VarMap: map[string]ast.Variable{
-						"var.class": ast.Variable{
-							Type:  ast.TypeString,
-							Value: j.Class,
-						},
-						"var.sequence": ast.Variable{
-							Type:  ast.TypeString,
-							Value: j.Sequence,
-						},
-						"var.locale": ast.Variable{
-							Type:  ast.TypeString,
-							Value: j.Locale,
-						},
-						"var.specname": ast.Variable{
-							Type:  ast.TypeString,
-							Value: j.SpecName,
-						},
-					},
-				},
-			}
-
-			result, err := hil.Eval(tree, config)
-			if err != nil {
-				j.Errors <- errors.New("Unable to evaluate file: " + file.Source)
-				return err
-			}
-
-			outputFile = []byte(result.Value.(string))
-		} else {
-
-			j.Notices <- "Skipping Interpolation on file: " + file.Destination
-
-			outputFile = fileBytes
-		}
-
-		// Write the file
-		////////////////..........
-		rf, err = os.Create("/tmp/crusher" + file.Destination)
-		defer rf.Close()
-
-		if err != nil {
-			j.Errors <- errors.New("Unable to create file: " + file.Destination)
-			return err
-		}
-		if _, err := rf.Write(outputFile); err != nil {
-			j.Errors <- errors.New("Unable to write file: " + file.Destination)
-			return err
-		}
-
-		// mv
-		j.runCommand("sudo mv /tmp/crusher"+file.Destination+" "+file.Destination, "")
-
-		j.Information <- "Completed copy of file: " + file.Destination
-	}
-
-	return nil
-
-}
-
 // Prints table of all available specs in a table
 func (s *SpecList) PrintSpecInformation() {
 	terminal.PrintAnsi(SpecTemplate, s)
@@ -565,11 +461,18 @@ var SpecTemplate = `{{range $name, $spec := .Specs}}
 
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}               Requires: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Requires }}{{ . }} {{ end }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}           Apt Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Packages.AptGet }}{{ . }} {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}           dnf Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Packages.Dnf }}{{ . }} {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}           yum Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Packages.Yum }}{{ . }} {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}           apk Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Packages.Apk }}{{ . }} {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}        pacman Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Packages.Pacman }}{{ . }} {{ end }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}        zypper Packages: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Packages.Zypper }}{{ . }} {{ end }}{{ ansi ""}}
 
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}    Debian Configs Root: {{ ansi ""}}{{ ansi "fgcyan"}}{{ $spec.Configs.DebianRoot }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}    Other Configs Roots: {{ ansi ""}}{{ ansi "fgcyan"}}{{ with $spec.Configs }}{{ if .RedHatRoot }}redhat: {{ .RedHatRoot }} {{ end }}{{ if .AlpineRoot }}alpine: {{ .AlpineRoot }} {{ end }}{{ if .ArchRoot }}arch: {{ .ArchRoot }} {{ end }}{{ if .SuseRoot }}suse: {{ .SuseRoot }} {{ end }}{{ if .DefaultRoot }}default: {{ .DefaultRoot }}{{ end }}{{ end }}{{ ansi ""}}
 
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}         Content Source: {{ ansi ""}}{{ ansi "fgcyan"}}{{ $spec.Content.Source }}{{ ansi ""}}
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}    Debian Content Root: {{ ansi ""}}{{ ansi "fgcyan"}}{{ $spec.Content.DebianRoot }}{{ ansi ""}}
+	{{ ansi "bright"}}{{ ansi "fgwhite"}}    Other Content Roots: {{ ansi ""}}{{ ansi "fgcyan"}}{{ with $spec.Content }}{{ if .RedHatRoot }}redhat: {{ .RedHatRoot }} {{ end }}{{ if .AlpineRoot }}alpine: {{ .AlpineRoot }} {{ end }}{{ if .ArchRoot }}arch: {{ .ArchRoot }} {{ end }}{{ if .SuseRoot }}suse: {{ .SuseRoot }} {{ end }}{{ if .DefaultRoot }}default: {{ .DefaultRoot }}{{ end }}{{ end }}{{ ansi ""}}
 
 	{{ ansi "bright"}}{{ ansi "fgwhite"}}  Pre-configure command: {{ ansi ""}}{{ ansi "fgcyan"}}{{ range $spec.Commands.Pre }}{{ printf "%s" . }}
 				 {{ end }}{{ ansi ""}}
@@ -694,36 +597,6 @@ func (s *SpecList) getPostCommands(specName string) []string {
 	return commands
 }
 
-// Recursive unexported func for AptGetCmds
-func (s *SpecList) getAptPackages(specName string) []string {
-	// The requested spec
-	spec := s.Specs[specName]
-	var packages []string
-	if spec == nil || spec.Packages.SkipPackages {
-		return nil
-	}
-
-	// Gather all required apt-get packages for this spec
-	packages = append(packages, spec.Packages.AptGet...)
-
-	// Loop through this specs requirements gather to all other apt-get packages we need
-	for _, reqSpec := range spec.Requires {
-		packages = append(packages, s.getAptPackages(reqSpec)...)
-	}
-
-	// Dedupe
-	for index := 0; index < len(packages); index++ {
-		for compare := index + 1; compare < len(packages); compare++ {
-			if packages[index] == packages[compare] {
-				packages = append(packages[:compare], packages[compare+1:]...)
-				compare--
-			}
-		}
-	}
-
-	return packages
-}
-
 func printTable(header []string, rows [][]string) {
 
 	table := tablewriter.NewWriter(os.Stdout)
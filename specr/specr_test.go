@@ -1,6 +1,18 @@
 package specr_test
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/murdinc/crusher/specr"
@@ -14,3 +26,391 @@ func TestGetSpecs(t *testing.T) {
 	assert.True(t, specList.SpecExists("hello_world"))
 
 }
+
+func TestFilePermissions(t *testing.T) {
+	specList, err := specr.GetSpecs()
+	assert.NoError(t, err)
+
+	permissions := make(map[string]specr.FileTransfer)
+	for _, file := range *specList.DebianFileTransferList("hello_world") {
+		permissions[file.Destination] = file
+	}
+
+	index := permissions["/var/www/html/hello_world/index.php"]
+	assert.Equal(t, "www-data:www-data", index.Chown)
+	assert.Equal(t, "0644", index.Chmod)
+	assert.Equal(t, "0755", index.DirChmod)
+
+	site := permissions["/etc/nginx/sites-available/default"]
+	assert.Equal(t, "root:root", site.Chown)
+	assert.Equal(t, "0644", site.Chmod)
+	assert.Equal(t, "", site.DirChmod)
+}
+
+func TestInvalidModes(t *testing.T) {
+	for _, mode := range []string{"7", "0999", "+644", "06440", "644 && reboot"} {
+		tmp, err := ioutil.TempDir("", "crusher-modes")
+		assert.NoError(t, err)
+		defer os.RemoveAll(tmp)
+
+		specs := tmp + "/specs/site"
+		assert.NoError(t, os.MkdirAll(specs, 0755))
+		spec := "NAME = site\n\n[CONFIGS]\n\tdebian_root = /etc/\n\tmode = " + mode + "\n"
+		assert.NoError(t, ioutil.WriteFile(specs+"/site.spec", []byte(spec), 0644))
+
+		cwd, _ := os.Getwd()
+		assert.NoError(t, os.Chdir(tmp))
+		_, err = specr.GetSpecs()
+		os.Chdir(cwd)
+
+		assert.Error(t, err, mode)
+	}
+}
+
+func TestHandlers(t *testing.T) {
+	specList, err := specr.GetSpecs()
+	assert.NoError(t, err)
+
+	// hello_world requires nginx, which owns the reload handler
+	handlers := specList.Handlers("hello_world")
+	assert.Len(t, handlers, 1)
+	assert.Equal(t, "nginx_reload", handlers[0].Name)
+	assert.Equal(t, "sudo service nginx reload", handlers[0].Command)
+
+	assert.True(t, handlers[0].Triggered([]string{"/etc/nginx/sites-available/default"}, nil))
+	assert.False(t, handlers[0].Triggered([]string{"/etc/nginx.conf.bak"}, nil))
+	assert.False(t, handlers[0].Triggered(nil, []string{"nginx"}))
+}
+
+func TestSyncRootExcluded(t *testing.T) {
+	root := specr.SyncRoot{Destination: "/var/www/html/", Exclude: []string{"uploads/", "*.log", "cache/*.tmp"}}
+
+	assert.True(t, root.Excluded("/var/www/html/uploads/cat.jpg"))
+	assert.True(t, root.Excluded("/var/www/html/logs/error.log"))
+	assert.True(t, root.Excluded("/var/www/html/cache/a.tmp"))
+	assert.False(t, root.Excluded("/var/www/html/index.php"))
+	assert.False(t, root.Excluded("/var/www/html/cache/a.php"))
+}
+
+func TestGitContent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-git")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// A bare repository with a tagged release and a newer commit on master
+	work := tmp + "/work"
+	bare := tmp + "/site.git"
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		return strings.TrimSpace(string(out))
+	}
+	run(tmp, "init", "--quiet", "--bare", bare)
+	run(tmp, "clone", "--quiet", bare, work)
+	run(work, "config", "user.email", "test@example.com")
+	run(work, "config", "user.name", "test")
+
+	assert.NoError(t, os.MkdirAll(work+"/public", 0755))
+	assert.NoError(t, ioutil.WriteFile(work+"/public/index.html", []byte("v1"), 0644))
+	assert.NoError(t, ioutil.WriteFile(work+"/README", []byte("readme"), 0644))
+	run(work, "add", ".")
+	run(work, "commit", "--quiet", "-m", "v1")
+	run(work, "tag", "v1")
+	tagged := run(work, "rev-parse", "HEAD")
+
+	assert.NoError(t, ioutil.WriteFile(work+"/public/index.html", []byte("v2"), 0644))
+	run(work, "commit", "--quiet", "-am", "v2")
+	run(work, "push", "--quiet", "origin", "HEAD:master", "--tags")
+
+	// A spec deploying the public folder of the tag
+	specs := tmp + "/specs/site"
+	assert.NoError(t, os.MkdirAll(specs, 0755))
+	spec := "NAME = site\n\n[CONTENT]\n\tsource = git\n\tgit_url = " + bare + "\n\tgit_ref = v1\n\tgit_subdir = public\n\tdebian_root = /var/www/\n"
+	assert.NoError(t, ioutil.WriteFile(specs+"/site.spec", []byte(spec), 0644))
+
+	// And one deploying master of the same repository
+	specs = tmp + "/specs/beta"
+	assert.NoError(t, os.MkdirAll(specs, 0755))
+	spec = "NAME = beta\n\n[CONTENT]\n\tsource = git\n\tgit_url = " + bare + "\n\tgit_ref = master\n\tgit_subdir = public\n\tdebian_root = /var/www/\n"
+	assert.NoError(t, ioutil.WriteFile(specs+"/beta.spec", []byte(spec), 0644))
+
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	assert.NoError(t, os.Chdir(tmp))
+
+	specr.CacheFolder = tmp + "/cache"
+	defer func() { specr.CacheFolder = "" }()
+
+	specList, err := specr.GetSpecs()
+	assert.NoError(t, err)
+	assert.NoError(t, specList.FetchContent("site"))
+	assert.Equal(t, tagged, specList.Specs["site"].ContentVersion)
+	assert.NoError(t, specList.FetchContent("beta"))
+	assert.NotEqual(t, tagged, specList.Specs["beta"].ContentVersion)
+
+	files := make(map[string]string)
+	for _, file := range *specList.DebianFileTransferList("site") {
+		files[file.Destination] = file.Source
+	}
+	assert.Len(t, files, 2)
+
+	index, err := ioutil.ReadFile(files["/var/www/index.html"])
+	assert.NoError(t, err)
+	assert.Equal(t, "v1", string(index))
+
+	deployed, err := ioutil.ReadFile(files[filepath.Join(specr.DeployedFolder, "site")])
+	assert.NoError(t, err)
+	assert.Contains(t, string(deployed), "commit = "+tagged)
+
+	// Fetching master left the tag alone
+	for _, file := range *specList.DebianFileTransferList("beta") {
+		files[file.Destination] = file.Source
+	}
+	index, err = ioutil.ReadFile(files["/var/www/index.html"])
+	assert.NoError(t, err)
+	assert.Equal(t, "v2", string(index))
+
+	deployed, err = ioutil.ReadFile(files[filepath.Join(specr.DeployedFolder, "beta")])
+	assert.NoError(t, err)
+	assert.Contains(t, string(deployed), "ref = master")
+}
+
+func TestArchiveContent(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-archive")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// A tarball with a single page, served over http
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	page := []byte("hello")
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "site/index.html", Mode: 0644, Size: int64(len(page)), Typeflag: tar.TypeReg}))
+	tw.Write(page)
+	tw.Close()
+	gz.Close()
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(archive.Bytes())
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(archive.Bytes())
+	writeSpec := func(sha string) {
+		specs := tmp + "/specs/site"
+		assert.NoError(t, os.MkdirAll(specs, 0755))
+		spec := "NAME = site\n\n[CONTENT]\n\tsource = archive\n\tarchive = " + server.URL + "/site.tar.gz\n\tarchive_sha256 = " + sha + "\n\tdebian_root = /var/www/\n"
+		assert.NoError(t, ioutil.WriteFile(specs+"/site.spec", []byte(spec), 0644))
+	}
+
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	assert.NoError(t, os.Chdir(tmp))
+
+	specr.CacheFolder = tmp + "/cache"
+	defer func() { specr.CacheFolder = "" }()
+
+	// A wrong sum is refused
+	writeSpec(strings.Repeat("0", 64))
+	specList, err := specr.GetSpecs()
+	assert.NoError(t, err)
+	assert.Error(t, specList.FetchContent("site"))
+
+	// The right one is extracted, and only downloaded once
+	writeSpec(hex.EncodeToString(sum[:]))
+	for i := 0; i < 2; i++ {
+		specList, err = specr.GetSpecs()
+		assert.NoError(t, err)
+		assert.NoError(t, specList.FetchContent("site"))
+	}
+	assert.Equal(t, 2, downloads)
+
+	files := make(map[string]string)
+	for _, file := range *specList.DebianFileTransferList("site") {
+		files[file.Destination] = file.Source
+	}
+	index, err := ioutil.ReadFile(files["/var/www/site/index.html"])
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(index))
+	assert.Contains(t, files, filepath.Join(specr.DeployedFolder, "site"))
+}
+
+func TestParseOSRelease(t *testing.T) {
+	distro, err := specr.ParseOSRelease("ID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\nPRETTY_NAME=\"Ubuntu 22.04.3 LTS\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, specr.Debian, distro.Family)
+	assert.Equal(t, specr.AptGet, distro.Manager)
+	assert.Equal(t, "Ubuntu 22.04.3 LTS", distro.Name)
+
+	distro, err = specr.ParseOSRelease("ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.2\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, specr.RedHat, distro.Family)
+	assert.Equal(t, specr.Dnf, distro.Manager)
+
+	distro, err = specr.ParseOSRelease("ID=\"centos\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"7\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, specr.Yum, distro.Manager)
+
+	distro, err = specr.ParseOSRelease("ID=opensuse-leap\nID_LIKE=\"suse opensuse\"\n")
+	assert.NoError(t, err)
+	assert.Equal(t, specr.Zypper, distro.Manager)
+
+	_, err = specr.ParseOSRelease("ID=plan9\n")
+	assert.Error(t, err)
+}
+
+func TestPackageCmds(t *testing.T) {
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{
+		"web":  {Requires: []string{"base"}, Packages: specr.Packages{AptGet: []string{"nginx"}, Yum: []string{"nginx"}}},
+		"base": {Packages: specr.Packages{AptGet: []string{"curl"}}},
+	}}
+
+	// dnf falls back to the yum packages
+	assert.Equal(t, []string{"sudo dnf install -y nginx"}, specList.PackageCmds("web", specr.Dnf))
+	assert.Equal(t, []string{"base"}, specList.SpecsWithoutPackages("web", specr.Dnf))
+	assert.Empty(t, specList.SpecsWithoutPackages("web", specr.AptGet))
+	assert.Equal(t, []string{"nginx", "curl"}, specList.AptPackages("web"))
+}
+
+func TestFileTransfersAreDeduped(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "crusher-dedupe")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	for _, name := range []string{"web", "left", "right", "base"} {
+		assert.NoError(t, os.MkdirAll(tmp+"/"+name+"/configs/app", 0755))
+		assert.NoError(t, ioutil.WriteFile(tmp+"/"+name+"/configs/app/"+name+".conf", []byte(name), 0644))
+		assert.NoError(t, ioutil.WriteFile(tmp+"/"+name+"/configs/app/shared.conf", []byte(name), 0644))
+	}
+
+	// base is required twice, through left and right
+	configs := specr.Configs{DebianRoot: "/etc/"}
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{
+		"web":   {SpecRoot: tmp + "/web", Configs: configs, Requires: []string{"left", "right"}},
+		"left":  {SpecRoot: tmp + "/left", Configs: configs, Requires: []string{"base"}},
+		"right": {SpecRoot: tmp + "/right", Configs: configs, Requires: []string{"base"}},
+		"base":  {SpecRoot: tmp + "/base", Configs: configs},
+	}}
+
+	sources := make(map[string]string)
+	for _, file := range *specList.DebianFileTransferList("web") {
+		_, seen := sources[file.Destination]
+		assert.False(t, seen, file.Destination)
+		sources[file.Destination] = file.Source
+	}
+
+	assert.Len(t, sources, 5)
+	assert.Equal(t, tmp+"/base/configs/app/base.conf", sources["/etc/app/base.conf"])
+
+	// The spec listed last wins
+	assert.Equal(t, tmp+"/base/configs/app/shared.conf", sources["/etc/app/shared.conf"])
+}
+
+func TestFamilyRoots(t *testing.T) {
+	// Only a debian_root applies everywhere
+	configs := specr.Configs{DebianRoot: "/etc/"}
+	assert.Equal(t, "/etc/", configs.Root(specr.Alpine))
+
+	configs = specr.Configs{DebianRoot: "/etc/", ArchRoot: "/usr/local/etc/", DefaultRoot: "/opt/etc/"}
+	assert.Equal(t, "/etc/", configs.Root(specr.Debian))
+	assert.Equal(t, "/usr/local/etc/", configs.Root(specr.Arch))
+	assert.Equal(t, "/opt/etc/", configs.Root(specr.RedHat))
+
+	configs = specr.Configs{DebianRoot: "/etc/", RedHatRoot: "/etc/"}
+	assert.Equal(t, "", configs.Root(specr.Suse))
+}
+
+func TestFamilyFolders(t *testing.T) {
+	root, err := ioutil.TempDir("", "crusher-families")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	assert.NoError(t, os.MkdirAll(root+"/configs/default", 0755))
+	assert.NoError(t, os.MkdirAll(root+"/configs/nginx", 0755))
+	assert.NoError(t, ioutil.WriteFile(root+"/configs/default/grub", []byte("grub"), 0644))
+	assert.NoError(t, ioutil.WriteFile(root+"/configs/nginx/nginx.conf", []byte("nginx"), 0644))
+
+	destinations := func(specList *specr.SpecList, family string) []string {
+		var files []string
+		for _, file := range *specList.FileTransferList("web", family) {
+			files = append(files, file.Destination)
+		}
+		return files
+	}
+
+	// Subfolders named after families are plain folders unless the spec opts in
+	spec := &specr.Spec{SpecRoot: root, Configs: specr.Configs{DebianRoot: "/etc/", Sync: true}}
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{"web": spec}}
+	assert.False(t, specList.FamilySpecific("web"))
+	assert.Equal(t, []string{"/etc/default/grub", "/etc/nginx/nginx.conf"}, destinations(specList, specr.Debian))
+
+	spec.Configs.FamilyFolders = true
+	assert.True(t, specList.FamilySpecific("web"))
+	assert.Equal(t, []string{"/etc/grub"}, destinations(specList, specr.Debian))
+	assert.Len(t, specList.SyncRoots("web", specr.Debian), 1)
+
+	// Without files for the family the root is not synced, so nothing there is deleted
+	assert.NoError(t, os.Rename(root+"/configs/default", root+"/configs/debian"))
+	assert.Empty(t, destinations(specList, specr.RedHat))
+	assert.Empty(t, specList.SyncRoots("web", specr.RedHat))
+	assert.Len(t, specList.SyncRoots("web", specr.Debian), 1)
+
+	// Nor is it without a configs folder at all
+	spec.SpecRoot = root + "/missing"
+	spec.Configs.FamilyFolders = false
+	assert.Empty(t, specList.SyncRoots("web", specr.Debian))
+}
+
+func TestAptPlan(t *testing.T) {
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{
+		"web":  {Requires: []string{"base"}, Packages: specr.Packages{AptGet: []string{"nginx=1.18.0-0ubuntu1", "curl"}, AptHold: []string{"nginx"}, AptPurge: []string{"apache2"}}},
+		"base": {Packages: specr.Packages{AptGet: []string{"curl=7.81.0-1"}}},
+	}}
+
+	plan, err := specList.AptPlan("web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"nginx=1.18.0-0ubuntu1", "curl=7.81.0-1"}, plan.Install)
+	assert.Equal(t, []string{"curl=7.81.0-1 (base)", "nginx=1.18.0-0ubuntu1 (web)"}, plan.PinList())
+	assert.Equal(t, []string{
+		"sudo apt-get update -o Dpkg::Options::=\"--force-confdef\" -o Dpkg::Options::=\"--force-confold\"",
+		"sudo apt-get install -y -f --assume-yes --allow-downgrades --allow-change-held-packages nginx=1.18.0-0ubuntu1 curl=7.81.0-1",
+		"sudo apt-mark hold nginx",
+	}, plan.Cmds())
+	assert.Equal(t, []string{"sudo apt-get purge -y apache2"}, plan.RemoveCmds(map[string]bool{"apache2": true}))
+	assert.Empty(t, plan.RemoveCmds(map[string]bool{}))
+
+	// Specs that disagree are errors
+	specList.Specs["base"].Packages.AptGet = []string{"nginx=1.20.0-1", "apache2"}
+	_, err = specList.AptPlan("web")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "[nginx] is pinned to [1.18.0-0ubuntu1] by spec [web] and to [1.20.0-1] by spec [base]")
+	assert.Contains(t, err.Error(), "[apache2] is installed by spec [base] and removed by spec [web]")
+}
+
+func TestAptAllowUnauthenticated(t *testing.T) {
+	allow, deny := true, false
+	specList := &specr.SpecList{Specs: map[string]*specr.Spec{
+		"web":  {Requires: []string{"base"}, Packages: specr.Packages{AptGet: []string{"nginx"}}},
+		"base": {Packages: specr.Packages{AptGet: []string{"curl"}}},
+	}}
+
+	// Authenticated packages only, unless a spec opts in
+	plan, err := specList.AptPlan("web")
+	assert.NoError(t, err)
+	assert.Equal(t, "sudo apt-get install -y -f --assume-yes nginx curl", plan.Cmds()[1])
+
+	specList.Specs["base"].Packages.AptAllowUnauthenticated = &allow
+	plan, err = specList.AptPlan("web")
+	assert.NoError(t, err)
+	assert.Equal(t, "sudo apt-get install -y -f --assume-yes --allow-unauthenticated nginx curl", plan.Cmds()[1])
+
+	// Specs that disagree are errors
+	specList.Specs["web"].Packages.AptAllowUnauthenticated = &deny
+	_, err = specList.AptPlan("web")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "[apt_allow_unauthenticated] is true in spec [base] and false in spec [web]")
+}
@@ -0,0 +1,69 @@
+package specr
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// A destination folder that mirrors a spec folder, files in it that are not transferred by the
+// spec are deleted
+type SyncRoot struct {
+	Destination string
+	Exclude     []string // Patterns relative to Destination of files to leave alone
+}
+
+// Returns the synced destination folders of a given spec and the specs it requires, on hosts of a family
+func (s *SpecList) SyncRoots(specName, family string) []SyncRoot {
+	return s.getSyncRoots(specName, family, make(map[string]bool))
+}
+
+// Recursive unexported func for SyncRoots
+func (s *SpecList) getSyncRoots(specName, family string, seen map[string]bool) []SyncRoot {
+	// The requested spec
+	spec := s.Specs[specName]
+	if spec == nil || seen[specName] {
+		return nil
+	}
+	seen[specName] = true
+
+	// Folders without source files for the family are left alone, rather than emptied
+	var roots []SyncRoot
+	if root := spec.Configs.Root(family); spec.Configs.Sync && root != "" && isDir(spec.configsFolder(family)) {
+		roots = append(roots, SyncRoot{Destination: root, Exclude: spec.Configs.Exclude})
+	}
+	if root := spec.Content.Root(family); spec.Content.Sync && root != "" && spec.Content.Source != "" && isDir(spec.contentSourceFolder(family)) {
+		roots = append(roots, SyncRoot{Destination: root, Exclude: spec.Content.Exclude})
+	}
+
+	for _, reqSpec := range spec.Requires {
+		if reqSpec != "" {
+			roots = append(roots, s.getSyncRoots(reqSpec, family, seen)...)
+		}
+	}
+
+	return roots
+}
+
+// Checks if a file under the destination folder matches one of the exclude patterns. Patterns
+// match the path relative to the folder, or its file name, and a pattern matching a folder
+// excludes everything under it
+func (r SyncRoot) Excluded(path string) bool {
+	rel := strings.TrimPrefix(path, strings.TrimSuffix(r.Destination, "/")+"/")
+
+	for _, pattern := range r.Exclude {
+		pattern = strings.Trim(pattern, "/")
+		if pattern == "" {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, filepath.Base(rel)); matched {
+			return true
+		}
+		for dir := rel; dir != "." && dir != "/"; dir = filepath.Dir(dir) {
+			if matched, _ := filepath.Match(pattern, dir); matched {
+				return true
+			}
+		}
+	}
+
+	return false
+}